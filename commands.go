@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+type options struct {
+	schema  string
+	seed    int64
+	format  string
+	lang    string
+	record  string
+	replay  string
+	workers int
+	batch   bool
+	addr    string
+	store   string
+
+	roller steaminventory.Roller
+
+	// the clock for serve; set by -now to always return the same time
+	now func() time.Time
+}
+
+type command struct {
+	name string
+	args string
+	help string
+	run  func(opts *options, args []string) error
+
+	// the command outputs items, so it supports the steam, csv, and tsv
+	// formats
+	items bool
+}
+
+// errUsage is returned by a command when it was given the wrong arguments.
+var errUsage = errors.New("usage")
+
+var commands = []*command{
+	{
+		name: "validate",
+		help: "check the item schemas for problems",
+		run:  runValidate,
+	},
+	{
+		name:  "simulate",
+		args:  "<scenario.json>",
+		help:  "run a drop simulation scenario",
+		run:   runSimulate,
+		items: true,
+	},
+	{
+		name:  "expand",
+		args:  "<itemdefid> [quantity]",
+		help:  "roll a generator or open a bundle",
+		run:   runExpand,
+		items: true,
+	},
+	{
+		name: "show",
+		args: "<itemdefid>",
+		help: "show an item definition",
+		run:  runShow,
+	},
+	{
+		name: "describe",
+		args: "<itemdefid> [key:value | property=value]...",
+		help: "render the description of an item with the given tags and dynamic properties",
+		run:  runDescribe,
+	},
+	{
+		name: "probabilities",
+		args: "<itemdefid>",
+		help: "calculate exact drop chances for a generator or bundle",
+		run:  runProbabilities,
+	},
+	{
+		name:  "craft",
+		args:  "<itemdefid> <itemdefid[xN][;key:value...]>...",
+		help:  "exchange the given materials for an item and show what is left",
+		run:   runCraft,
+		items: true,
+	},
+	{
+		name: "cost",
+		args: "<itemdefid> [quantity]",
+		help: "calculate the base materials needed to craft an item",
+		run:  runCost,
+	},
+	{
+		name: "explain",
+		args: "<rolls.json>",
+		help: "describe the random choices recorded with -record",
+		run:  runExplain,
+	},
+	{
+		name: "diff",
+		args: "<old schema> <new schema>",
+		help: "compare two sets of item schemas",
+		run:  runDiff,
+	},
+	{
+		name: "serve",
+		help: "run a mock of the Steam Inventory Web API (IInventoryService)",
+		run:  runServe,
+	},
+	{
+		name: "translations",
+		help: "report missing translations for each language and schema file",
+		run:  runTranslations,
+	},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+func runValidate(opts *options, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+
+	if opts.format == "json" {
+		problems := []string{}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				problems = append(problems, e.Error())
+			}
+		} else if err != nil {
+			problems = append(problems, err.Error())
+		}
+
+		writeJSON(struct {
+			Items    int      `json:"items"`
+			Problems []string `json:"problems"`
+		}{
+			Items:    len(defs),
+			Problems: problems,
+		})
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d item definitions OK\n", len(defs))
+
+	return nil
+}
+
+func runSimulate(opts *options, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	scenario, err := loadScenario(args[0], defs)
+	if err != nil {
+		return err
+	}
+
+	if opts.record != "" || opts.replay != "" {
+		return fmt.Errorf("simulate uses a separate random source for each worker; -record and -replay are not supported")
+	}
+
+	if opts.format == "text" {
+		fmt.Printf("Simulating total drops for %d players playing for %d days...\n\n", scenario.Players, scenario.Days)
+	}
+
+	var store *InventoryStore
+	if opts.store != "" {
+		store, err = openInventoryStore(opts.store)
+		if err != nil {
+			return err
+		}
+	}
+
+	items, counters, err := scenario.run(defs, opts.seed, opts.workers, opts.batch, store)
+
+	if store != nil {
+		if closeErr := store.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	sortItems(items)
+
+	writeItems(opts, defs, items, steaminventory.OriginPlaytime)
+
+	if opts.format == "text" && len(counters) != 0 {
+		fmt.Printf("\nStrange counters after %d days:\n\n", scenario.Days)
+		printCounters(counters)
+	}
+
+	return nil
+}
+
+func printCounters(counters []CounterSummary) {
+	for _, counter := range counters {
+		average := 0.0
+		if counter.Items != 0 {
+			average = float64(counter.Total) / float64(counter.Items)
+		}
+
+		fmt.Printf("%-20s%-28s%8d items, average %.1f, highest %d\n", counter.Counter, counter.Name, counter.Items, average, counter.Highest)
+	}
+}
+
+func runExpand(opts *options, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseItemDefID(defs, args[0])
+	if err != nil {
+		return err
+	}
+
+	quantity := int64(1)
+	if len(args) == 2 {
+		quantity, err = strconv.ParseInt(args[1], 10, 32)
+		if err != nil {
+			return err
+		}
+
+		if quantity <= 0 {
+			return fmt.Errorf("invalid quantity: %d", quantity)
+		}
+	}
+
+	if err = steaminventory.CheckExpandable(def); err != nil {
+		return err
+	}
+
+	// large quantities take time proportional to the quantity unless all
+	// units of each generator are rolled at once
+	generate := steaminventory.GenerateItems
+	if opts.batch && quantity > steaminventory.BatchRollThreshold {
+		generate = steaminventory.GenerateItemsBatch
+	}
+
+	items, err := generate(defs, steaminventory.TaggedBundleDefs{
+		{
+			Item:     def.ID,
+			Quantity: quantity,
+		},
+	}, opts.roller)
+	if err != nil {
+		return err
+	}
+
+	sortItems(items)
+
+	origin := steaminventory.OriginExternal
+	if def.Type == "playtimegenerator" {
+		origin = steaminventory.OriginPlaytime
+	}
+
+	writeItems(opts, defs, items, origin)
+
+	return nil
+}
+
+func runShow(opts *options, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseItemDefID(defs, args[0])
+	if err != nil {
+		return err
+	}
+
+	fields := itemDefFields(def)
+
+	if opts.format == "json" {
+		obj := make(map[string]string, len(fields))
+		for _, f := range fields {
+			obj[f.name] = f.value
+		}
+
+		writeJSON(obj)
+
+		return nil
+	}
+
+	name, displayType := itemNames(defs, def.ID, opts.lang)
+	fmt.Printf("#%d %s (%s)\t\t%s\n", def.ID, name, displayType, def.File)
+	for _, f := range fields {
+		fmt.Printf("\t%s: %s\n", f.name, f.value)
+	}
+
+	return nil
+}
+
+func runDescribe(opts *options, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseItemDefID(defs, args[0])
+	if err != nil {
+		return err
+	}
+
+	item := &steaminventory.ItemInstance{
+		Item:         def.ID,
+		Quantity:     1,
+		DynamicProps: make(map[string]int64),
+	}
+
+	for _, arg := range args[1:] {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			item.DynamicProps[name], err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for dynamic property %s: %w", name, err)
+			}
+
+			continue
+		}
+
+		var kv steaminventory.KeyValuePair
+		err = kv.UnmarshalText([]byte(arg))
+		if err != nil {
+			return err
+		}
+
+		item.Tags = append(item.Tags, kv)
+	}
+
+	description, renderErr := steaminventory.RenderDescription(defs, item, opts.lang)
+
+	name, displayType := itemNames(defs, def.ID, opts.lang)
+	if opts.format == "json" {
+		writeJSON(struct {
+			Item        int32  `json:"itemdefid"`
+			Name        string `json:"name"`
+			DisplayType string `json:"display_type"`
+			Description string `json:"description"`
+		}{def.ID, name, displayType, description})
+	} else {
+		fmt.Printf("#%d %s (%s)\n%s\n", def.ID, name, displayType, description)
+	}
+
+	return renderErr
+}
+
+func runProbabilities(opts *options, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseItemDefID(defs, args[0])
+	if err != nil {
+		return err
+	}
+
+	outcomes, err := steaminventory.DropProbabilities(defs, def.ID)
+	if err != nil {
+		return err
+	}
+
+	if opts.format == "json" {
+		type jsonOutcome struct {
+			Item         int32                        `json:"itemdefid"`
+			Tags         steaminventory.KeyValuePairs `json:"tags,omitempty"`
+			Probability  string                       `json:"probability"`
+			Expected     string                       `json:"expected_quantity"`
+			Distribution map[string]string            `json:"distribution"`
+		}
+
+		result := make([]jsonOutcome, len(outcomes))
+		for i, outcome := range outcomes {
+			result[i] = jsonOutcome{
+				Item:         outcome.Item,
+				Tags:         outcome.Tags,
+				Probability:  outcome.Probability.RatString(),
+				Expected:     outcome.Expected.RatString(),
+				Distribution: make(map[string]string, len(outcome.Distribution)),
+			}
+
+			for q, p := range outcome.Distribution {
+				result[i].Distribution[strconv.FormatInt(q, 10)] = p.RatString()
+			}
+		}
+
+		writeJSON(result)
+
+		return nil
+	}
+
+	printProbabilities(defs, outcomes, opts.lang)
+
+	return nil
+}
+
+func runCraft(opts *options, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseItemDefID(defs, args[0])
+	if err != nil {
+		return err
+	}
+
+	inventory := make(steaminventory.TaggedBundleDefs, len(args)-1)
+	for i, arg := range args[1:] {
+		inventory[i], err = parseMaterial(defs, arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	items, err := steaminventory.CraftItem(defs, inventory, def.ID)
+	if err != nil {
+		return err
+	}
+
+	writeItems(opts, defs, items, steaminventory.OriginExchange)
+
+	return nil
+}
+
+// parseMaterial parses an item for craft: an itemdefid with an optional
+// quantity, followed by the tags of the item instance.
+func parseMaterial(defs map[int32]*steaminventory.ItemDef, s string) (steaminventory.TaggedBundleDef, error) {
+	id, tags, hasTags := strings.Cut(s, ";")
+
+	var b steaminventory.BundleDef
+	if err := b.UnmarshalText([]byte(id)); err != nil {
+		return steaminventory.TaggedBundleDef{}, fmt.Errorf("invalid material %q: %w", s, err)
+	}
+
+	if _, ok := defs[b.Item]; !ok {
+		return steaminventory.TaggedBundleDef{}, fmt.Errorf("item %d does not exist", b.Item)
+	}
+
+	item := steaminventory.TaggedBundleDef{
+		Item:     b.Item,
+		Quantity: int64(b.Quantity),
+	}
+
+	if hasTags {
+		if err := item.Tags.UnmarshalText([]byte(tags)); err != nil {
+			return steaminventory.TaggedBundleDef{}, fmt.Errorf("invalid material %q: %w", s, err)
+		}
+	}
+
+	return item, nil
+}
+
+func runCost(opts *options, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseItemDefID(defs, args[0])
+	if err != nil {
+		return err
+	}
+
+	quantity := int64(1)
+	if len(args) == 2 {
+		quantity, err = strconv.ParseInt(args[1], 10, 32)
+		if err != nil {
+			return err
+		}
+
+		if quantity <= 0 {
+			return fmt.Errorf("invalid quantity: %d", quantity)
+		}
+	}
+
+	cost, err := steaminventory.CraftingCost(defs, def.ID, int32(quantity))
+	if err != nil {
+		return err
+	}
+
+	if opts.format == "json" {
+		type jsonInput struct {
+			Item     int32                        `json:"itemdefid,omitempty"`
+			Tag      *steaminventory.KeyValuePair `json:"tag,omitempty"`
+			Quantity int32                        `json:"quantity"`
+		}
+
+		result := make([]jsonInput, len(cost))
+		for i, input := range cost {
+			result[i] = jsonInput{
+				Item:     input.Item,
+				Quantity: input.Quantity,
+			}
+
+			if input.Item == 0 {
+				result[i].Tag = &cost[i].Tag
+			}
+		}
+
+		writeJSON(result)
+
+		return nil
+	}
+
+	for _, input := range cost {
+		if input.Item == 0 {
+			fmt.Printf("%dx\t\titem tagged %s:%s\n", input.Quantity, input.Tag.Key, input.Tag.Value)
+
+			continue
+		}
+
+		name, displayType := itemNames(defs, input.Item, opts.lang)
+		fmt.Printf("%dx\t\t#%d %s (%s)\n", input.Quantity, input.Item, name, displayType)
+	}
+
+	return nil
+}
+
+func runExplain(opts *options, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	defs, err := steaminventory.LoadItemDefs(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	rolls, err := steaminventory.LoadRolls(args[0])
+	if err != nil {
+		return err
+	}
+
+	for i, roll := range rolls {
+		fmt.Printf("%d\t%s\n", i, explainRoll(defs, roll, opts.lang))
+	}
+
+	return nil
+}
+
+type itemDefChange struct {
+	Item   int32  `json:"itemdefid"`
+	Change string `json:"change"`
+	Field  string `json:"field,omitempty"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+func runDiff(opts *options, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	oldDefs, err := steaminventory.LoadItemDefs(args[0])
+	if err != nil {
+		return err
+	}
+
+	newDefs, err := steaminventory.LoadItemDefs(args[1])
+	if err != nil {
+		return err
+	}
+
+	changes := diffItemDefs(oldDefs, newDefs)
+
+	if opts.format == "json" {
+		writeJSON(changes)
+
+		return nil
+	}
+
+	for _, c := range changes {
+		switch c.Change {
+		case "added":
+			name, _ := itemNames(newDefs, c.Item, opts.lang)
+			fmt.Printf("+ #%d %s\n", c.Item, name)
+		case "removed":
+			name, _ := itemNames(oldDefs, c.Item, opts.lang)
+			fmt.Printf("- #%d %s\n", c.Item, name)
+		case "changed":
+			fmt.Printf("~ #%d %s: %q -> %q\n", c.Item, c.Field, c.Old, c.New)
+		}
+	}
+
+	return nil
+}
+
+func diffItemDefs(oldDefs, newDefs map[int32]*steaminventory.ItemDef) []itemDefChange {
+	var ids []int32
+	for id := range oldDefs {
+		ids = append(ids, id)
+	}
+	for id := range newDefs {
+		if _, ok := oldDefs[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	changes := []itemDefChange{}
+	for _, id := range ids {
+		oldDef, inOld := oldDefs[id]
+		newDef, inNew := newDefs[id]
+
+		if !inOld {
+			changes = append(changes, itemDefChange{Item: id, Change: "added"})
+
+			continue
+		}
+
+		if !inNew {
+			changes = append(changes, itemDefChange{Item: id, Change: "removed"})
+
+			continue
+		}
+
+		oldFields := make(map[string]string)
+		for _, f := range itemDefFields(oldDef) {
+			oldFields[f.name] = f.value
+		}
+
+		newFields := make(map[string]string)
+		for _, f := range itemDefFields(newDef) {
+			newFields[f.name] = f.value
+		}
+
+		// walk the fields in struct order so the output is stable
+		for _, name := range itemDefFieldNames() {
+			if oldFields[name] != newFields[name] {
+				changes = append(changes, itemDefChange{
+					Item:   id,
+					Change: "changed",
+					Field:  name,
+					Old:    oldFields[name],
+					New:    newFields[name],
+				})
+			}
+		}
+	}
+
+	return changes
+}
+
+type itemDefField struct {
+	name  string
+	value string
+}
+
+// itemDefFields returns the fields of def that are set, in schema syntax.
+func itemDefFields(def *steaminventory.ItemDef) []itemDefField {
+	var fields []itemDefField
+
+	v := reflect.ValueOf(def).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || v.Field(i).IsZero() {
+			continue
+		}
+
+		fields = append(fields, itemDefField{
+			name:  name,
+			value: formatField(v.Field(i)),
+		})
+	}
+
+	return fields
+}
+
+func itemDefFieldNames() []string {
+	var names []string
+
+	t := reflect.TypeOf(steaminventory.ItemDef{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func formatField(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			panic(err)
+		}
+
+		return string(b)
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func parseItemDefID(defs map[int32]*steaminventory.ItemDef, s string) (*steaminventory.ItemDef, error) {
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid item id %q", s)
+	}
+
+	def, ok := defs[int32(id)]
+	if !ok {
+		return nil, fmt.Errorf("item %d does not exist", id)
+	}
+
+	return def, nil
+}
+
+func runServe(opts *options, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	defs, files, err := steaminventory.LoadSchemaFiles(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	appID := files[0].AppID
+	for _, file := range files[1:] {
+		if file.AppID != appID {
+			return fmt.Errorf("%s has appid %d, but %s has appid %d", file.Name, file.AppID, files[0].Name, appID)
+		}
+	}
+
+	service := newInventoryService(defs, appID, opts.roller)
+	service.now = opts.now
+	if opts.store != "" {
+		service.store, err = openInventoryStore(opts.store)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server := &http.Server{
+		Addr:    opts.addr,
+		Handler: service,
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+		close(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving IInventoryService for app %d on %s\n", appID, opts.addr)
+
+	err = server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		// wait for requests that are still running
+		<-shutdown
+		err = nil
+	}
+
+	if service.store != nil {
+		if closeErr := service.store.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func runTranslations(opts *options, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	defs, files, err := steaminventory.LoadSchemaFiles(opts.schema)
+	if err != nil {
+		return err
+	}
+
+	reports := translationReports(defs, files)
+	totals := languageTotals(reports)
+
+	if opts.format == "json" {
+		writeJSON(struct {
+			Files     []TranslationReport `json:"files"`
+			Languages []LanguageCoverage  `json:"languages"`
+		}{reports, totals})
+
+		return nil
+	}
+
+	for _, report := range reports {
+		fmt.Println(report.File)
+		if report.TranslatorNote != "" {
+			fmt.Printf("\tnote: %s\n", report.TranslatorNote)
+		}
+
+		for _, coverage := range report.Languages {
+			if coverage.Total == 0 {
+				continue
+			}
+
+			printCoverage(coverage)
+
+			var fields []string
+			missing := make(map[string][]string)
+			for _, m := range coverage.Missing {
+				if _, ok := missing[m.Field]; !ok {
+					fields = append(fields, m.Field)
+				}
+
+				missing[m.Field] = append(missing[m.Field], fmt.Sprintf("#%d", m.Item))
+			}
+
+			for _, field := range fields {
+				fmt.Printf("\t\tmissing %s: %s\n", field, strings.Join(missing[field], " "))
+			}
+
+			for _, p := range coverage.Placeholders {
+				fmt.Printf("\t\tplaceholders in #%d %s: %v (expected %v)\n", p.Item, p.Field, p.Found, p.Expected)
+			}
+		}
+
+		fmt.Println()
+	}
+
+	fmt.Println("all files")
+	for _, coverage := range totals {
+		printCoverage(coverage)
+	}
+
+	return nil
+}
+
+func printCoverage(coverage LanguageCoverage) {
+	percent := "-"
+	if coverage.Total != 0 {
+		percent = strconv.FormatFloat(float64(coverage.Translated)*100/float64(coverage.Total), 'f', 1, 64) + "%"
+	}
+
+	fmt.Printf("\t%-12s%7s (%d/%d", coverage.Language, percent, coverage.Translated, coverage.Total)
+	if len(coverage.Placeholders) != 0 {
+		fmt.Printf(", %d with mismatched placeholders", len(coverage.Placeholders))
+	}
+	fmt.Println(")")
+}
+
+// writeItems writes items in the output format. The steam format grants the
+// items to a new inventory with the given origin, acquired at the start of
+// the scenario.
+func writeItems(opts *options, defs map[int32]*steaminventory.ItemDef, items steaminventory.TaggedBundleDefs, origin string) {
+	switch opts.format {
+	case "steam":
+		writeJSON(steaminventory.SteamInventory(defs, items, scenarioStart, origin))
+
+		return
+	case "csv":
+		writeItemsCSV(defs, items, ',', opts.lang)
+
+		return
+	case "tsv":
+		writeItemsCSV(defs, items, '\t', opts.lang)
+
+		return
+	}
+
+	if opts.format == "json" {
+		type jsonItem struct {
+			Item     int32                        `json:"itemdefid"`
+			Name     string                       `json:"name"`
+			Quantity int64                        `json:"quantity"`
+			Tags     steaminventory.KeyValuePairs `json:"tags,omitempty"`
+		}
+
+		result := make([]jsonItem, len(items))
+		for i, item := range items {
+			name, _ := itemNames(defs, item.Item, opts.lang)
+			result[i] = jsonItem{
+				Item:     item.Item,
+				Name:     name,
+				Quantity: item.Quantity,
+				Tags:     item.Tags,
+			}
+		}
+
+		writeJSON(result)
+
+		return
+	}
+
+	printItems(defs, items, opts.lang)
+}
+
+func writeJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	err := enc.Encode(v)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// explainRoll describes what a recorded roll chose.
+func explainRoll(defs map[int32]*steaminventory.ItemDef, roll steaminventory.Roll, lang string) string {
+	def, ok := defs[roll.Item]
+	if !ok {
+		return fmt.Sprintf("rolled %d of %d", roll.Value, roll.N)
+	}
+
+	name, _ := itemNames(defs, roll.Item, lang)
+
+	if roll.N == steaminventory.BatchRollN {
+		return fmt.Sprintf("#%d %s drew %.6f for a batch of rolls", roll.Item, name, float64(roll.Value)/steaminventory.BatchRollN)
+	}
+
+	weight := roll.Value
+	if def.Type == "tag_generator" {
+		for _, option := range def.TagGeneratorValues {
+			weight -= int64(option.Weight)
+			if weight < 0 {
+				return fmt.Sprintf("#%d %s rolled %d of %d: %s:%s (weight %d)", roll.Item, name, roll.Value, roll.N, def.TagGeneratorName, option.Value, option.Weight)
+			}
+		}
+	} else {
+		for _, option := range def.Bundle {
+			weight -= int64(option.Quantity)
+			if weight < 0 {
+				optionName, _ := itemNames(defs, option.Item, lang)
+
+				return fmt.Sprintf("#%d %s rolled %d of %d: #%d %s (weight %d)", roll.Item, name, roll.Value, roll.N, option.Item, optionName, option.Quantity)
+			}
+		}
+	}
+
+	return fmt.Sprintf("#%d %s rolled %d of %d: out of range", roll.Item, name, roll.Value, roll.N)
+}
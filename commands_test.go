@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+func TestDiffItemDefs(t *testing.T) {
+	oldDefs := map[int32]*steaminventory.ItemDef{
+		1: {ID: 1, Type: "item", Name: "Hat"},
+		2: {ID: 2, Type: "bundle", Name: "Hats", Bundle: steaminventory.BundleDefs{{Item: 1, Quantity: 2}}},
+		3: {ID: 3, Type: "item", Name: "Scarf"},
+	}
+	newDefs := map[int32]*steaminventory.ItemDef{
+		1: {ID: 1, Type: "item", Name: "Hat"},
+		2: {ID: 2, Type: "bundle", Name: "Hats", Bundle: steaminventory.BundleDefs{{Item: 1, Quantity: 3}, {Item: 4, Quantity: 1}}},
+		4: {ID: 4, Type: "item", Name: "Gloves"},
+	}
+
+	want := []itemDefChange{
+		{Item: 2, Change: "changed", Field: "bundle", Old: "1x2", New: "1x3;4"},
+		{Item: 3, Change: "removed"},
+		{Item: 4, Change: "added"},
+	}
+
+	if got := diffItemDefs(oldDefs, newDefs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := diffItemDefs(oldDefs, oldDefs); len(got) != 0 {
+		t.Errorf("got %+v comparing a schema to itself", got)
+	}
+}
+
+func TestExplainRoll(t *testing.T) {
+	defs := map[int32]*steaminventory.ItemDef{
+		1: {ID: 1, Type: "item", Name: "Hat"},
+		2: {ID: 2, Type: "item", Name: "Scarf"},
+		3: {ID: 3, Type: "generator", Name: "Clothes", Bundle: steaminventory.BundleDefs{{Item: 1, Quantity: 1}, {Item: 2, Quantity: 3}}},
+	}
+
+	tests := []struct {
+		roll steaminventory.Roll
+		want string
+	}{
+		{steaminventory.Roll{Item: 3, N: 4, Value: 0}, "#3 Clothes rolled 0 of 4: #1 Hat (weight 1)"},
+		{steaminventory.Roll{Item: 3, N: 4, Value: 3}, "#3 Clothes rolled 3 of 4: #2 Scarf (weight 3)"},
+		{steaminventory.Roll{Item: 3, N: steaminventory.BatchRollN, Value: steaminventory.BatchRollN / 4}, "#3 Clothes drew 0.250000 for a batch of rolls"},
+		{steaminventory.Roll{Item: 3, N: 5, Value: 4}, "#3 Clothes rolled 4 of 5: out of range"},
+		{steaminventory.Roll{Item: 99999, N: 5, Value: 4}, "rolled 4 of 5"},
+	}
+
+	for _, tt := range tests {
+		if got := explainRoll(defs, tt.roll, "english"); got != tt.want {
+			t.Errorf("explainRoll(%+v) = %q, want %q", tt.roll, got, tt.want)
+		}
+	}
+}
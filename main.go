@@ -1,238 +1,132 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
 )
 
 func main() {
-	defs, err := loadItemDefs()
-	if err != nil {
-		panic(err)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd := findCommand(os.Args[1])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	opts := &options{
+		now: time.Now,
+	}
+
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s [flags] %s\n\n%s\n\n", filepath.Base(os.Args[0]), cmd.name, cmd.args, cmd.help)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.schema, "schema", "item-schema-*.json", "item schema files to load (a glob or a directory)")
+	flags.Int64Var(&opts.seed, "seed", 0, "random seed for generators")
+	flags.StringVar(&opts.format, "format", "text", "output format (text or json; commands that output items also support steam for the Steam Inventory API format, csv, and tsv)")
+	flags.StringVar(&opts.record, "record", "", "save every random choice to this file")
+	flags.StringVar(&opts.replay, "replay", "", "repeat the random choices saved in this file instead of using -seed")
+	flags.StringVar(&opts.lang, "lang", "english", "language for item names and descriptions, as a Steam API language name")
+	flags.IntVar(&opts.workers, "workers", runtime.GOMAXPROCS(0), "number of goroutines to run simulations on")
+	flags.BoolVar(&opts.batch, "batch", true, "roll all units of a generator at once in simulations and large expansions (set to false to roll each unit separately)")
+	flags.StringVar(&opts.addr, "addr", "localhost:8080", "address for serve to listen on")
+	flags.StringVar(&opts.store, "store", "", "directory to save inventories in, so serve and simulate can continue where they left off")
+	flags.IntVar(&steaminventory.MaxExpansionDepth, "max-depth", steaminventory.MaxExpansionDepth, "maximum number of item expansion passes")
+	flags.Func("now", "pretend the current time is always this RFC 3339 time, so serve gives the same output for the same requests (time does not pass, so TriggerItemDrop calls add no playtime)", func(s string) error {
+		now, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+
+		opts.now = func() time.Time {
+			return now
+		}
+
+		return nil
+	})
+	_ = flags.Parse(os.Args[2:])
+
+	switch opts.format {
+	case "text", "json":
+	case "steam", "csv", "tsv":
+		if !cmd.items {
+			fmt.Fprintf(os.Stderr, "%s does not output items; -format %s is not supported\n", cmd.name, opts.format)
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", opts.format)
+		os.Exit(2)
+	}
+
+	if !steaminventory.IsLanguage(opts.lang) {
+		fmt.Fprintf(os.Stderr, "unknown language %q\n", opts.lang)
+		os.Exit(2)
 	}
 
-	if false {
-		// lifetime guaranteed rares
-		items := generateItems(defs, TaggedBundleDefs{
-			{
-				// Random Drop Pool Guaranteed Rare
-				// (drops after playing 100 hours, max once per 90 days, max 5 times lifetime)
-				Item:     7021,
-				Quantity: 5,
-			},
-		})
+	opts.roller = steaminventory.NewRoller(opts.seed)
+
+	var replayer *steaminventory.RollReplayer
+	if opts.replay != "" {
+		rolls, err := steaminventory.LoadRolls(opts.replay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		replayer = &steaminventory.RollReplayer{Rolls: rolls}
+		opts.roller = replayer
+	}
 
-		sortItems(items)
+	var recorder *steaminventory.RollRecorder
+	if opts.record != "" {
+		recorder = &steaminventory.RollRecorder{Roller: opts.roller}
+		opts.roller = recorder
+	}
 
-		printItems(defs, items)
+	err := cmd.run(opts, flags.Args())
+	if errors.Is(err, errUsage) {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if replayer != nil && replayer.Err() != nil {
+		// the output was made with the wrong choices
+		err = replayer.Err()
 	}
+	if err == nil && recorder != nil {
+		err = steaminventory.SaveRolls(opts.record, recorder.Rolls)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	if true {
-		// potential daily drops for simulated players
-		const (
-			daysForSimulation = 7
-			dailyPlayerCount  = 10000
-
-			playtime15MinutesWeight  = 10  // 0.25 hours
-			playtime30MinutesWeight  = 100 // 0.5 hours
-			playtime45MinutesWeight  = 150 // 0.75 hours
-			playtime60MinutesWeight  = 150 // 1 hour
-			playtime75MinutesWeight  = 10  // 1.25 hours
-			playtime90MinutesWeight  = 5   // 1.5 hours
-			playtime180MinutesWeight = 1   // 3 hours
-			playtime270MinutesWeight = 1   // 4.5 hours
-			playtime360MinutesWeight = 1   // 6 hours
-			playtime450MinutesWeight = 1   // 7.5 hours
-
-			officerMarineWeight        = 5
-			specialWeaponsMarineWeight = 5
-			medicMarineWeight          = 6
-			techMarineWeight           = 8
-
-			missionFallbackWeight                   = 0
-			missionWorkshopCompetitionWeight        = 1
-			missionWorkshopCampaignAWeight          = 1
-			missionWorkshopCampaignBWeight          = 1
-			missionWorkshopBonusAWeight             = 1
-			missionWorkshopBonusBWeight             = 1
-			missionStandaloneOfficialMissionsWeight = 10
-			missionEndlessWeight                    = 1
-			missionDeathmatchWeight                 = 1
-			missionJacobsRestWeight                 = 100
-			missionArea9800Weight                   = 10
-			missionOperationCleansweepWeight        = 10
-			missionResearch7Weight                  = 10
-			missionTearsForTarnorWeight             = 10
-			missionTilarus5Weight                   = 10
-			missionLanasEscapeWeight                = 10
-			missionParanoiaWeight                   = 10
-			missionNamHumanumWeight                 = 10
-			missionBioGenCorporationWeight          = 10
-			missionAccident32Weight                 = 40
-			missionAdanaxisWeight                   = 40
-
-			playtimeTotalWeight = playtime15MinutesWeight + playtime30MinutesWeight + playtime45MinutesWeight + playtime60MinutesWeight + playtime75MinutesWeight + playtime90MinutesWeight + playtime180MinutesWeight + playtime270MinutesWeight + playtime360MinutesWeight + playtime450MinutesWeight
-			totalMarineWeight   = officerMarineWeight + specialWeaponsMarineWeight + medicMarineWeight + techMarineWeight
-			totalMissionWeight  = missionFallbackWeight + missionWorkshopCompetitionWeight + missionWorkshopCampaignAWeight + missionWorkshopCampaignBWeight + missionWorkshopBonusAWeight + missionWorkshopBonusBWeight + missionStandaloneOfficialMissionsWeight + missionEndlessWeight + missionDeathmatchWeight + missionJacobsRestWeight + missionArea9800Weight + missionOperationCleansweepWeight + missionResearch7Weight + missionTearsForTarnorWeight + missionTilarus5Weight + missionLanasEscapeWeight + missionParanoiaWeight + missionNamHumanumWeight + missionBioGenCorporationWeight + missionAccident32Weight + missionAdanaxisWeight
-
-			totalNormalDrops       = daysForSimulation * dailyPlayerCount * (5*playtimeTotalWeight - 4*playtime15MinutesWeight + 3*playtime30MinutesWeight - 2*playtime45MinutesWeight - playtime60MinutesWeight) / playtimeTotalWeight
-			totalMissionDrops      = totalNormalDrops / 2
-			totalMarineDrops       = totalNormalDrops - totalMissionDrops
-			totalExtendedFarmDrops = daysForSimulation * dailyPlayerCount * (playtime90MinutesWeight + 2*playtime180MinutesWeight + 3*playtime270MinutesWeight + 4*playtime360MinutesWeight + 5*playtime450MinutesWeight) / playtimeTotalWeight
-
-			totalMarineDropsMissed  = totalMarineDrops - (totalMarineDrops * officerMarineWeight / totalMarineWeight) - (totalMarineDrops * specialWeaponsMarineWeight / totalMarineWeight) - (totalMarineDrops * medicMarineWeight / totalMarineWeight) - (totalMarineDrops * techMarineWeight / totalMarineWeight)
-			totalMissionDropsMissed = totalMissionDrops - (totalMissionDrops * missionFallbackWeight / totalMissionWeight) - (totalMissionDrops * missionWorkshopCompetitionWeight / totalMissionWeight) - (totalMissionDrops * missionWorkshopCampaignAWeight / totalMissionWeight) - (totalMissionDrops * missionWorkshopCampaignBWeight / totalMissionWeight) - (totalMissionDrops * missionWorkshopBonusAWeight / totalMissionWeight) - (totalMissionDrops * missionWorkshopBonusBWeight / totalMissionWeight) - (totalMissionDrops * missionStandaloneOfficialMissionsWeight / totalMissionWeight) - (totalMissionDrops * missionEndlessWeight / totalMissionWeight) - (totalMissionDrops * missionDeathmatchWeight / totalMissionWeight) - (totalMissionDrops * missionJacobsRestWeight / totalMissionWeight) - (totalMissionDrops * missionArea9800Weight / totalMissionWeight) - (totalMissionDrops * missionOperationCleansweepWeight / totalMissionWeight) - (totalMissionDrops * missionResearch7Weight / totalMissionWeight) - (totalMissionDrops * missionTearsForTarnorWeight / totalMissionWeight) - (totalMissionDrops * missionTilarus5Weight / totalMissionWeight) - (totalMissionDrops * missionLanasEscapeWeight / totalMissionWeight) - (totalMissionDrops * missionParanoiaWeight / totalMissionWeight) - (totalMissionDrops * missionNamHumanumWeight / totalMissionWeight) - (totalMissionDrops * missionBioGenCorporationWeight / totalMissionWeight) - (totalMissionDrops * missionAccident32Weight / totalMissionWeight) - (totalMissionDrops * missionAdanaxisWeight / totalMissionWeight)
-		)
-
-		fmt.Printf("Simulating total drops for %d players playing for %d days...\n\n", dailyPlayerCount, daysForSimulation)
-
-		items := generateItems(defs, TaggedBundleDefs{
-			// Unless specified:
-			// Drop tables are chosen at the end of a mission.
-			// 50% chance for marine class; 50% chance for one of the others.
-			// Drops can happen every 15 minutes, up to 5 times per day.
-			{
-				// Random Drop Pool Fallback
-				Item:     7000,
-				Quantity: totalMissionDrops*missionFallbackWeight/totalMissionWeight + totalMissionDropsMissed,
-			},
-			{
-				// Random Drop Pool Workshop Competition
-				Item:     7001,
-				Quantity: totalMissionDrops * missionWorkshopCompetitionWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Workshop Campaign A
-				Item:     7002,
-				Quantity: totalMissionDrops * missionWorkshopCampaignAWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Workshop Campaign B
-				Item:     7003,
-				Quantity: totalMissionDrops * missionWorkshopCampaignBWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Workshop Bonus A
-				Item:     7004,
-				Quantity: totalMissionDrops * missionWorkshopBonusAWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Workshop Bonus B
-				Item:     7005,
-				Quantity: totalMissionDrops * missionWorkshopBonusBWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Standalone Official Missions
-				Item:     7006,
-				Quantity: totalMissionDrops * missionStandaloneOfficialMissionsWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Endless
-				Item:     7007,
-				Quantity: totalMissionDrops * missionEndlessWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Deathmatch
-				Item:     7008,
-				Quantity: totalMissionDrops * missionDeathmatchWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Jacob's Rest
-				Item:     7009,
-				Quantity: totalMissionDrops * missionJacobsRestWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Area 9800
-				Item:     7010,
-				Quantity: totalMissionDrops * missionArea9800Weight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Operation Cleansweep
-				Item:     7011,
-				Quantity: totalMissionDrops * missionOperationCleansweepWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Research 7
-				Item:     7012,
-				Quantity: totalMissionDrops * missionResearch7Weight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Tears for Tarnor
-				Item:     7013,
-				Quantity: totalMissionDrops * missionTearsForTarnorWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Tilarus-5
-				Item:     7014,
-				Quantity: totalMissionDrops * missionTilarus5Weight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Lana's Escape
-				Item:     7015,
-				Quantity: totalMissionDrops * missionLanasEscapeWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Paranoia
-				Item:     7016,
-				Quantity: totalMissionDrops * missionParanoiaWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Nam Humanum
-				Item:     7017,
-				Quantity: totalMissionDrops * missionNamHumanumWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool BioGen Corporation
-				Item:     7018,
-				Quantity: totalMissionDrops * missionBioGenCorporationWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Accident 32
-				Item:     7019,
-				Quantity: totalMissionDrops * missionAccident32Weight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Adanaxis
-				Item:     7020,
-				Quantity: totalMissionDrops * missionAdanaxisWeight / totalMissionWeight,
-			},
-			{
-				// Random Drop Pool Marine Class Officer
-				Item:     7025,
-				Quantity: totalMarineDrops * officerMarineWeight / totalMarineWeight,
-			},
-			{
-				// Random Drop Pool Marine Class Special Weapons
-				Item:     7026,
-				Quantity: totalMarineDrops*specialWeaponsMarineWeight/totalMarineWeight + totalMarineDropsMissed,
-			},
-			{
-				// Random Drop Pool Marine Class Medic
-				Item:     7027,
-				Quantity: totalMarineDrops * medicMarineWeight / totalMarineWeight,
-			},
-			{
-				// Random Drop Pool Marine Class Tech
-				Item:     7028,
-				Quantity: totalMarineDrops * techMarineWeight / totalMarineWeight,
-			},
-			{
-				// Random Drop Pool Extended Farm
-				// (every 90 minutes, no daily limit)
-				Item:     7029,
-				Quantity: totalExtendedFarmDrops,
-			},
-		})
-
-		sortItems(items)
-
-		printItems(defs, items)
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags] [arguments]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-40s %s\n", cmd.name+" "+cmd.args, cmd.help)
 	}
+	fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' for the flags of a command\n", filepath.Base(os.Args[0]))
 }
 
-func sortItems(items TaggedBundleDefs) {
+func sortItems(items steaminventory.TaggedBundleDefs) {
 	sort.Slice(items, func(i, j int) bool {
 		if items[i].Quantity != items[j].Quantity {
 			return items[i].Quantity > items[j].Quantity
@@ -246,52 +140,68 @@ func sortItems(items TaggedBundleDefs) {
 	})
 }
 
-func printItems(defs map[int32]*ItemDef, items TaggedBundleDefs) {
+func printItems(defs map[int32]*steaminventory.ItemDef, items steaminventory.TaggedBundleDefs, lang string) {
 	for _, item := range items {
-		def := defs[item.Item]
-		name := def.NameEnglish
-		if name == "" {
-			name = def.Name
-		}
-		if name == "" {
-			name = fmt.Sprintf("UNNAMED ITEM #%d", item.Item)
-		}
+		name, displayType := itemNames(defs, item.Item, lang)
+		tags := formatTags(defs, item.Item, item.Tags, lang)
 
-		displayType := def.DisplayTypeEnglish
-		if displayType == "" {
-			displayType = def.DisplayType
-		}
-		if displayType == "" {
-			displayType = "<no display type>"
+		uniqueStar := ""
+		if len(item.Tags) != 0 {
+			uniqueStar = "*"
 		}
 
-		allTags := append(append(KeyValuePairs(nil), def.Tags...), item.Tags...)
-
-		tagStrings := make([]string, len(allTags))
-		for i, kv := range allTags {
-			value := kv.Value
-			if def.AccessoryTag == kv.Key {
-				id, err := strconv.ParseInt(kv.Value, 10, 32)
-				if err == nil {
-					value = defs[int32(id)].NameEnglish
-					if value == "" {
-						value = defs[int32(id)].Name
-					}
-					if value == "" {
-						value = kv.Value
-					}
-				}
-			}
+		fmt.Printf("%dx\t\t#%d%s %s (%s)\t\t%s\n", item.Quantity, item.Item, uniqueStar, name, displayType, tags)
+	}
+}
 
-			tagStrings[i] = kv.Key + ":" + value
-		}
-		tags := strings.Join(tagStrings, ";")
+func printProbabilities(defs map[int32]*steaminventory.ItemDef, outcomes steaminventory.DropOutcomes, lang string) {
+	for _, outcome := range outcomes {
+		name, displayType := itemNames(defs, outcome.Item, lang)
+		tags := formatTags(defs, outcome.Item, outcome.Tags, lang)
 
 		uniqueStar := ""
-		if len(item.Tags) != 0 {
+		if len(outcome.Tags) != 0 {
 			uniqueStar = "*"
 		}
 
-		fmt.Printf("%dx\t\t#%d%s %s (%s)\t\t%s\n", item.Quantity, item.Item, uniqueStar, name, displayType, tags)
+		fmt.Printf("%s%%\t%s\t\t#%d%s %s (%s)\t\t%s\n\t\t(chance %s; expected quantity %s)\n", new(big.Rat).Mul(outcome.Probability, big.NewRat(100, 1)).FloatString(6), outcome.Expected.FloatString(6), outcome.Item, uniqueStar, name, displayType, tags, outcome.Probability.RatString(), outcome.Expected.RatString())
 	}
 }
+
+func itemNames(defs map[int32]*steaminventory.ItemDef, id int32, lang string) (name, displayType string) {
+	def := defs[id]
+	name = def.LocalizedName(lang)
+	if name == "" {
+		name = fmt.Sprintf("UNNAMED ITEM #%d", id)
+	}
+
+	displayType = def.LocalizedDisplayType(lang)
+	if displayType == "" {
+		displayType = "<no display type>"
+	}
+
+	return
+}
+
+func formatTags(defs map[int32]*steaminventory.ItemDef, id int32, tags steaminventory.KeyValuePairs, lang string) string {
+	def := defs[id]
+	allTags := append(append(steaminventory.KeyValuePairs(nil), def.Tags...), tags...)
+
+	tagStrings := make([]string, len(allTags))
+	for i, kv := range allTags {
+		value := kv.Value
+		if def.AccessoryTag == kv.Key {
+			id, err := strconv.ParseInt(kv.Value, 10, 32)
+			if err == nil {
+				value = defs[int32(id)].LocalizedName(lang)
+				if value == "" {
+					value = kv.Value
+				}
+			}
+		}
+
+		tagStrings[i] = kv.Key + ":" + value
+	}
+
+	return strings.Join(tagStrings, ";")
+}
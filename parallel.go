@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// simulationChunkSize is the number of units of an item that are expanded
+// with the same random source by generateItemsParallel when it is not in
+// batch mode.
+const simulationChunkSize = 4096
+
+// random streams for subSeed
+const (
+	streamGenerate = iota + 1
+	streamPlayers
+)
+
+// subSeed derives an independent seed for one unit of work from the seed
+// for the whole simulation, using the SplitMix64 finalizer.
+func subSeed(seed int64, stream, index int) int64 {
+	x := uint64(seed) ^ uint64(stream)<<56 ^ uint64(index)*0x9e3779b97f4a7c15
+
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return int64(x)
+}
+
+// generateItemsParallel works like GenerateItems, but splits the items into
+// chunks that are expanded on separate goroutines. Every chunk has its own
+// random source derived from seed, so the result only depends on seed, not
+// on the number of workers. In batch mode, each item is a single chunk
+// expanded by GenerateItemsBatch.
+func generateItemsParallel(defs map[int32]*steaminventory.ItemDef, items steaminventory.TaggedBundleDefs, seed int64, workers int, batch bool) (steaminventory.TaggedBundleDefs, error) {
+	chunkSize := int64(simulationChunkSize)
+	generate := steaminventory.GenerateItems
+	if batch {
+		chunkSize = math.MaxInt64
+		generate = steaminventory.GenerateItemsBatch
+	}
+
+	var chunks []steaminventory.TaggedBundleDef
+	for _, item := range items {
+		for remaining := item.Quantity; remaining > 0; remaining -= chunkSize {
+			chunk := item
+			if chunk.Quantity = remaining; chunk.Quantity > chunkSize {
+				chunk.Quantity = chunkSize
+			}
+
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	results, err := runParallel(len(chunks), workers, func(i int) (steaminventory.TaggedBundleDefs, error) {
+		return generate(defs, steaminventory.TaggedBundleDefs{chunks[i]}, steaminventory.NewRoller(subSeed(seed, streamGenerate, i)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeResults(results), nil
+}
+
+// runParallel calls work for every index in [0, n) using up to workers
+// goroutines, and returns the results in index order. Every index is run
+// even if some fail; the errors are joined in index order.
+func runParallel(n, workers int, work func(i int) (steaminventory.TaggedBundleDefs, error)) ([]steaminventory.TaggedBundleDefs, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]steaminventory.TaggedBundleDefs, n)
+	errs := make([]error, n)
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range next {
+				results[i], errs[i] = work(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+func mergeResults(results []steaminventory.TaggedBundleDefs) steaminventory.TaggedBundleDefs {
+	var merged steaminventory.ItemAggregator
+
+	for _, result := range results {
+		merged.AddAll(result)
+	}
+
+	return merged.Items
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+func TestGenerateItemsParallelSeed(t *testing.T) {
+	defs := testItemDefs(t)
+	items := steaminventory.TaggedBundleDefs{
+		{Item: 7000, Quantity: 3 * simulationChunkSize},
+		{Item: 6000, Quantity: 100},
+	}
+
+	for _, batch := range []bool{false, true} {
+		want, err := generateItemsParallel(defs, items, 1, 1, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, workers := range []int{1, 4} {
+			got, err := generateItemsParallel(defs, items, 1, workers, batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("batch=%v: %d workers gave a different result for the same seed", batch, workers)
+			}
+		}
+
+		other, err := generateItemsParallel(defs, items, 2, 1, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reflect.DeepEqual(other, want) {
+			t.Errorf("batch=%v: seeds 1 and 2 gave the same result", batch)
+		}
+	}
+}
+
+func TestRunParallelErrors(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	ran := make([]bool, 10)
+	results, err := runParallel(len(ran), 3, func(i int) (steaminventory.TaggedBundleDefs, error) {
+		ran[i] = true
+		if i%2 == 1 {
+			return nil, errOdd
+		}
+
+		return steaminventory.TaggedBundleDefs{{Item: int32(i), Quantity: 1}}, nil
+	})
+
+	if !errors.Is(err, errOdd) {
+		t.Errorf("got error %v, want %v", err, errOdd)
+	}
+
+	for i := range ran {
+		if !ran[i] {
+			t.Errorf("index %d was not run", i)
+		}
+
+		if i%2 == 0 && (len(results[i]) != 1 || results[i][0].Item != int32(i)) {
+			t.Errorf("result %d is %v", i, results[i])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// writeItemsCSV writes one row per item and tag set, with a column for each
+// tag key found on the items or their definitions. The rarity tag always
+// gets a column.
+func writeItemsCSV(defs map[int32]*steaminventory.ItemDef, items steaminventory.TaggedBundleDefs, comma rune, lang string) {
+	total := int64(0)
+	keySet := make(map[string]bool)
+	for _, item := range items {
+		total += int64(item.Quantity)
+
+		for _, kv := range defs[item.Item].Tags {
+			keySet[kv.Key] = true
+		}
+		for _, kv := range item.Tags {
+			keySet[kv.Key] = true
+		}
+	}
+
+	delete(keySet, "rarity")
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	keys = append([]string{"rarity"}, keys...)
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = comma
+
+	header := append([]string{"itemdefid", "name", "display_type", "quantity", "percent"}, keys...)
+	_ = w.Write(header)
+
+	for _, item := range items {
+		name, displayType := itemNames(defs, item.Item, lang)
+
+		percent := 0.0
+		if total != 0 {
+			percent = float64(item.Quantity) * 100 / float64(total)
+		}
+
+		row := []string{
+			strconv.Itoa(int(item.Item)),
+			name,
+			displayType,
+			strconv.FormatInt(item.Quantity, 10),
+			strconv.FormatFloat(percent, 'f', 6, 64),
+		}
+
+		for _, key := range keys {
+			row = append(row, tagValues(defs[item.Item].Tags, item.Tags, key))
+		}
+
+		_ = w.Write(row)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		panic(err)
+	}
+}
+
+// tagValues returns every value of key in the definition and instance tags,
+// separated by semicolons.
+func tagValues(defTags, tags steaminventory.KeyValuePairs, key string) string {
+	var values []string
+	for _, kv := range defTags {
+		if kv.Key == key {
+			values = append(values, kv.Value)
+		}
+	}
+	for _, kv := range tags {
+		if kv.Key == key {
+			values = append(values, kv.Value)
+		}
+	}
+
+	return strings.Join(values, ";")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// captureStdout returns everything f writes to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+
+	f()
+
+	_ = w.Close()
+
+	return string(<-done)
+}
+
+func TestWriteItemsCSV(t *testing.T) {
+	defs := map[int32]*steaminventory.ItemDef{
+		1: {ID: 1, Type: "item", Name: "Hat, Red", DisplayType: "Hat", Tags: steaminventory.KeyValuePairs{{Key: "rarity", Value: "common"}}},
+		2: {ID: 2, Type: "item", Name: "Scarf"},
+	}
+	items := steaminventory.TaggedBundleDefs{
+		{Item: 1, Quantity: 3, Tags: steaminventory.KeyValuePairs{{Key: "quality", Value: "unique"}}},
+		{Item: 2, Quantity: 1},
+	}
+
+	tests := []struct {
+		name  string
+		comma rune
+		want  string
+	}{
+		{
+			name:  "csv",
+			comma: ',',
+			want: "itemdefid,name,display_type,quantity,percent,rarity,quality\n" +
+				"1,\"Hat, Red\",Hat,3,75.000000,common,unique\n" +
+				"2,Scarf,<no display type>,1,25.000000,,\n",
+		},
+		{
+			name:  "tsv",
+			comma: '\t',
+			want: "itemdefid\tname\tdisplay_type\tquantity\tpercent\trarity\tquality\n" +
+				"1\tHat, Red\tHat\t3\t75.000000\tcommon\tunique\n" +
+				"2\tScarf\t<no display type>\t1\t25.000000\t\t\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := captureStdout(t, func() {
+				writeItemsCSV(defs, items, tt.comma, "english")
+			})
+
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,739 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// Scenario describes a drop simulation. It is loaded from a JSON file so
+// that the simulation can be tweaked without changing any code.
+type Scenario struct {
+	Description string `json:"description"`
+	Players     int32  `json:"players"`
+	Days        int32  `json:"days"`
+
+	// how long each player plays each day
+	Playtime []PlaytimeBucket `json:"playtime"`
+
+	// drops that are estimated from the average playtime
+	Pools []DropPool `json:"pools"`
+
+	// playtimegenerators that are triggered for each simulated player,
+	// following their drop_interval, drop_window, and drop_limit
+	Triggers []DropTrigger `json:"triggers"`
+
+	// items like the Strange Item Token that are given to each simulated
+	// player and exchanged for equipment
+	Tokens *TokenGrant `json:"tokens"`
+
+	// gameplay events that increment the Strange counters of the items the
+	// triggers and tokens give to each simulated player
+	Missions *MissionEvents `json:"missions"`
+}
+
+type PlaytimeBucket struct {
+	Minutes int32 `json:"minutes"`
+	Weight  int32 `json:"weight"`
+}
+
+// DropPool is a set of generators that share a drop timer.
+type DropPool struct {
+	Name string `json:"name"`
+
+	// minutes of playtime between drops
+	Interval int32 `json:"interval"`
+	// maximum drops per day, or 0 for no limit
+	DailyLimit int32 `json:"daily_limit"`
+
+	// each drop goes to one of the groups, split by weight
+	Groups []DropGroup `json:"groups"`
+}
+
+type DropGroup struct {
+	Name       string         `json:"name"`
+	Weight     int32          `json:"weight"`
+	Generators []ScenarioDrop `json:"generators"`
+}
+
+type ScenarioDrop struct {
+	Item int32  `json:"item"`
+	Name string `json:"name"`
+
+	Weight int32 `json:"weight"`
+	// drops lost to rounding are given to this generator
+	Remainder bool `json:"remainder"`
+}
+
+type DropTrigger struct {
+	Item int32  `json:"item"`
+	Name string `json:"name"`
+
+	// minutes of playtime between calls to TriggerItemDrop
+	Interval int32 `json:"interval"`
+}
+
+type TokenGrant struct {
+	Item int32  `json:"item"`
+	Name string `json:"name"`
+
+	// days between grants, starting on the first day
+	Interval int32 `json:"interval"`
+	Quantity int32 `json:"quantity"`
+
+	// exchange tokens for a random item the player can access as soon as
+	// they are granted
+	Redeem bool `json:"redeem"`
+
+	// chance of each player having unlocked each class
+	Classes []ClassUnlock `json:"classes"`
+}
+
+type ClassUnlock struct {
+	Class   string `json:"class"`
+	Percent int32  `json:"percent"`
+}
+
+type MissionEvents struct {
+	// minutes of playtime per mission
+	Length int32 `json:"length"`
+
+	// counters that every item tracking them gets at the end of each
+	// mission, as if the player had used all of their items
+	Counters []CounterEvent `json:"counters"`
+}
+
+type CounterEvent struct {
+	// dynamic property declared by a Strange Device, like strange_5002
+	Counter string `json:"counter"`
+	Name    string `json:"name"`
+
+	// each mission adds a random amount between min and max to the counter
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+
+	// start the counter from 0 each mission, like a kill streak; the
+	// highest value is kept in its _best counter
+	Reset bool `json:"reset"`
+}
+
+// loadScenario loads a scenario and checks it against the item schema.
+func loadScenario(name string, defs map[int32]*steaminventory.ItemDef) (*Scenario, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s Scenario
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	err = s.validate(defs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &s, nil
+}
+
+// hash identifies the scenario's settings, ignoring how its file is
+// formatted.
+func (s *Scenario) hash() (string, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *Scenario) validate(defs map[int32]*steaminventory.ItemDef) error {
+	if s.Players <= 0 {
+		return fmt.Errorf("players must be positive")
+	}
+
+	if s.Days <= 0 {
+		return fmt.Errorf("days must be positive")
+	}
+
+	for _, bucket := range s.Playtime {
+		if bucket.Minutes < 0 || bucket.Weight < 0 {
+			return fmt.Errorf("playtime: minutes and weight must not be negative")
+		}
+	}
+
+	if s.playtimeTotalWeight() <= 0 {
+		return fmt.Errorf("playtime distribution is empty")
+	}
+
+	for _, pool := range s.Pools {
+		if pool.Interval <= 0 {
+			return fmt.Errorf("pool %q: interval must be positive", pool.Name)
+		}
+
+		if pool.DailyLimit < 0 {
+			return fmt.Errorf("pool %q: daily_limit must not be negative", pool.Name)
+		}
+
+		totalGroupWeight := int64(0)
+		for _, group := range pool.Groups {
+			if group.Weight < 0 {
+				return fmt.Errorf("pool %q: group %q: weight must not be negative", pool.Name, group.Name)
+			}
+
+			totalGroupWeight += int64(group.Weight)
+
+			remainders := 0
+			totalWeight := int64(0)
+			for _, drop := range group.Generators {
+				if drop.Remainder {
+					remainders++
+				}
+
+				if drop.Weight < 0 {
+					return fmt.Errorf("pool %q: group %q: generator %d: weight must not be negative", pool.Name, group.Name, drop.Item)
+				}
+
+				totalWeight += int64(drop.Weight)
+
+				if err := checkScenarioItem(defs, drop.Item, "generator", "playtimegenerator", "bundle", "item", "tag_tool"); err != nil {
+					return fmt.Errorf("pool %q: group %q: %w", pool.Name, group.Name, err)
+				}
+			}
+
+			if remainders != 1 {
+				return fmt.Errorf("pool %q: group %q must have exactly one remainder generator", pool.Name, group.Name)
+			}
+
+			if totalWeight <= 0 {
+				return fmt.Errorf("pool %q: group %q: generator weights must add up to more than 0", pool.Name, group.Name)
+			}
+		}
+
+		if len(pool.Groups) != 0 && totalGroupWeight <= 0 {
+			return fmt.Errorf("pool %q: group weights must add up to more than 0", pool.Name)
+		}
+	}
+
+	for _, trigger := range s.Triggers {
+		if trigger.Interval <= 0 {
+			return fmt.Errorf("trigger %d: interval must be positive", trigger.Item)
+		}
+
+		if err := checkScenarioItem(defs, trigger.Item, "playtimegenerator"); err != nil {
+			return fmt.Errorf("trigger: %w", err)
+		}
+	}
+
+	if s.Tokens != nil {
+		if s.Tokens.Interval <= 0 {
+			return fmt.Errorf("tokens: interval must be positive")
+		}
+
+		if s.Tokens.Quantity <= 0 {
+			return fmt.Errorf("tokens: quantity must be positive")
+		}
+
+		if err := checkScenarioItem(defs, s.Tokens.Item, "item", "tag_tool"); err != nil {
+			return fmt.Errorf("tokens: %w", err)
+		}
+
+		for _, unlock := range s.Tokens.Classes {
+			if unlock.Percent < 0 || unlock.Percent > 100 {
+				return fmt.Errorf("tokens: class %q: percent must be between 0 and 100", unlock.Class)
+			}
+		}
+	}
+
+	if s.Missions != nil {
+		if s.Missions.Length <= 0 {
+			return fmt.Errorf("missions: length must be positive")
+		}
+
+		if len(s.Triggers) == 0 && s.Tokens == nil {
+			return fmt.Errorf("missions: counters are only tracked for the items from triggers and tokens")
+		}
+
+		for _, event := range s.Missions.Counters {
+			if strings.HasSuffix(event.Counter, steaminventory.BestCounterSuffix) || !isDeviceCounter(defs, event.Counter) {
+				return fmt.Errorf("missions: %q is not a counter of any Strange Device", event.Counter)
+			}
+
+			if event.Min < 0 || event.Max < event.Min {
+				return fmt.Errorf("missions: counter %q: min must not be negative or more than max", event.Counter)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isDeviceCounter returns true if a tag_tool declares name as one of its
+// dynamic properties.
+func isDeviceCounter(defs map[int32]*steaminventory.ItemDef, name string) bool {
+	for _, def := range defs {
+		if def.Type != "tag_tool" {
+			continue
+		}
+
+		for _, prop := range def.CompressedDynamicProps {
+			if prop == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkScenarioItem returns an error if id is not in the item schema or is
+// not one of the given types.
+func checkScenarioItem(defs map[int32]*steaminventory.ItemDef, id int32, types ...string) error {
+	def, ok := defs[id]
+	if !ok {
+		return fmt.Errorf("item %d does not exist", id)
+	}
+
+	for _, t := range types {
+		if def.Type == t {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("item %d is a %s, not a %s", id, def.Type, strings.Join(types, " or "))
+}
+
+func (s *Scenario) playtimeTotalWeight() int64 {
+	total := int64(0)
+	for _, bucket := range s.Playtime {
+		total += int64(bucket.Weight)
+	}
+
+	return total
+}
+
+// poolDrops returns the roots that the drop pools expand from, with the
+// number of drops from each pool estimated from the average daily playtime.
+func (s *Scenario) poolDrops() steaminventory.TaggedBundleDefs {
+	var items steaminventory.TaggedBundleDefs
+
+	for _, pool := range s.Pools {
+		dropsPerPlayerWeight := int64(0)
+		for _, bucket := range s.Playtime {
+			drops := int64(bucket.Minutes / pool.Interval)
+			if pool.DailyLimit != 0 && drops > int64(pool.DailyLimit) {
+				drops = int64(pool.DailyLimit)
+			}
+
+			dropsPerPlayerWeight += drops * int64(bucket.Weight)
+		}
+
+		totalDrops := int64(s.Days) * int64(s.Players) * dropsPerPlayerWeight / s.playtimeTotalWeight()
+
+		totalGroupWeight := int64(0)
+		for _, group := range pool.Groups {
+			totalGroupWeight += int64(group.Weight)
+		}
+
+		remainingDrops := totalDrops
+		for i, group := range pool.Groups {
+			groupDrops := totalDrops * int64(group.Weight) / totalGroupWeight
+			if i == len(pool.Groups)-1 {
+				groupDrops = remainingDrops
+			}
+			remainingDrops -= groupDrops
+
+			items = append(items, group.drops(groupDrops)...)
+		}
+	}
+
+	return items
+}
+
+func (g *DropGroup) drops(total int64) steaminventory.TaggedBundleDefs {
+	totalWeight := int64(0)
+	for _, drop := range g.Generators {
+		totalWeight += int64(drop.Weight)
+	}
+
+	items := make(steaminventory.TaggedBundleDefs, len(g.Generators))
+
+	missed := total
+	remainder := 0
+	for i, drop := range g.Generators {
+		quantity := total * int64(drop.Weight) / totalWeight
+		missed -= quantity
+
+		if drop.Remainder {
+			remainder = i
+		}
+
+		items[i] = steaminventory.TaggedBundleDef{
+			Item:     drop.Item,
+			Quantity: quantity,
+		}
+	}
+
+	items[remainder].Quantity += missed
+
+	return items
+}
+
+// randomPlaytime picks a daily playtime from the scenario's distribution.
+func (s *Scenario) randomPlaytime(r steaminventory.Roller) time.Duration {
+	weight := r.Roll(0, s.playtimeTotalWeight())
+	for _, bucket := range s.Playtime {
+		weight -= int64(bucket.Weight)
+		if weight < 0 {
+			return time.Duration(bucket.Minutes) * time.Minute
+		}
+	}
+
+	panic("unreachable")
+}
+
+// steamIDBase is the SteamID64 of individual account 0. Simulated player i
+// is saved in an InventoryStore as account i+1.
+const steamIDBase = 76561197960265728
+
+// scenarioStart is the time the first day of every scenario starts.
+var scenarioStart = time.Date(2017, time.April, 20, 0, 0, 0, 0, time.UTC)
+
+// run simulates the scenario and returns everything the players received,
+// along with the Strange counters of their items. The work is split between
+// workers goroutines; the result only depends on seed. If batch is true,
+// drop pools are rolled with GenerateItemsBatch. If store is not nil, the
+// simulated players are saved in it, and players who were already simulated
+// with the same scenario and seed are loaded from it instead of being
+// simulated again. A store can't be used with drop pools, which are
+// estimated rather than simulated for each player.
+func (s *Scenario) run(defs map[int32]*steaminventory.ItemDef, seed int64, workers int, batch bool, store *InventoryStore) (steaminventory.TaggedBundleDefs, []CounterSummary, error) {
+	if store != nil {
+		if len(s.Pools) != 0 {
+			return nil, nil, fmt.Errorf("drop pools are not simulated for each player, so they can't be saved with -store")
+		}
+
+		hash, err := s.hash()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err = store.useScenario(hash, seed); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var items steaminventory.ItemAggregator
+
+	if len(s.Pools) != 0 {
+		pools, err := generateItemsParallel(defs, s.poolDrops(), seed, workers, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items.AddAll(pools)
+	}
+
+	if len(s.Triggers) == 0 && s.Tokens == nil {
+		return items.Items, nil, nil
+	}
+
+	ids := &steaminventory.ItemIDAllocator{}
+
+	var counters counterTotals
+
+	players, err := runParallel(int(s.Players), workers, func(i int) (steaminventory.TaggedBundleDefs, error) {
+		r := steaminventory.NewRoller(subSeed(seed, streamPlayers, i))
+
+		var player *steaminventory.SimulatedPlayer
+		if store == nil {
+			player = steaminventory.NewSimulatedPlayer(ids)
+			if err := s.runPlayer(defs, r, player, nil); err != nil {
+				return nil, err
+			}
+		} else {
+			var err error
+			player, err = s.resumePlayer(defs, r, store, steamIDBase+uint64(i)+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		counters.add(defs, player.Inventory)
+
+		return player.Inventory.Bundles(), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items.AddAll(mergeResults(players))
+
+	return items.Items, counters.summaries(s.Missions), nil
+}
+
+// resumePlayer loads a player who finished the scenario from store, or
+// simulates them from the start, saving every change in store.
+func (s *Scenario) resumePlayer(defs map[int32]*steaminventory.ItemDef, r steaminventory.Roller, store *InventoryStore, steamID uint64) (*steaminventory.SimulatedPlayer, error) {
+	if player := store.player(steamID); player.Days >= s.Days {
+		return player, nil
+	}
+
+	player, err := store.reset(steamID, "Reset", scenarioStart)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.runPlayer(defs, r, player, func(action string, now time.Time, changed []*steaminventory.ItemInstance) error {
+		return store.record(steamID, action, now, player, changed)
+	})
+
+	return player, err
+}
+
+// runPlayer simulates the scenario's triggers, token grants, and missions
+// for a single player. If record is not nil, it is called after each step
+// with the items that step changed, and the simulation stops if it returns
+// an error.
+func (s *Scenario) runPlayer(defs map[int32]*steaminventory.ItemDef, r steaminventory.Roller, player *steaminventory.SimulatedPlayer, record func(action string, now time.Time, changed []*steaminventory.ItemInstance) error) error {
+	if record == nil {
+		record = func(string, time.Time, []*steaminventory.ItemInstance) error {
+			return nil
+		}
+	}
+
+	// step through each day at an interval that lines up with every trigger
+	// and the end of every mission
+	step := time.Duration(0)
+	for _, trigger := range s.Triggers {
+		step = gcdDuration(step, time.Duration(trigger.Interval)*time.Minute)
+	}
+
+	if s.Missions != nil {
+		step = gcdDuration(step, time.Duration(s.Missions.Length)*time.Minute)
+	}
+
+	if s.Tokens != nil {
+		for _, unlock := range s.Tokens.Classes {
+			if r.Roll(0, 100) < int64(unlock.Percent) {
+				player.Classes = append(player.Classes, unlock.Class)
+			}
+		}
+
+		if err := record("UnlockClasses", scenarioStart, nil); err != nil {
+			return err
+		}
+	}
+
+	for ; player.Days < s.Days; player.Days++ {
+		day := player.Days
+		now := scenarioStart.AddDate(0, 0, int(day))
+
+		if s.Tokens != nil && day%s.Tokens.Interval == 0 {
+			granted := player.Inventory.Grant(defs, steaminventory.TaggedBundleDefs{{Item: s.Tokens.Item, Quantity: int64(s.Tokens.Quantity)}}, now, steaminventory.OriginPromo)
+			if err := record("GrantTokens", now, granted); err != nil {
+				return err
+			}
+
+			if s.Tokens.Redeem {
+				redeemed, err := player.RedeemTokens(defs, r, s.Tokens.Item, now)
+				if err != nil {
+					return err
+				}
+
+				if err = record("RedeemTokens", now, redeemed); err != nil {
+					return err
+				}
+			}
+		}
+
+		playtime := s.randomPlaytime(r)
+		if step == 0 {
+			player.Play(playtime)
+
+			continue
+		}
+
+		played := time.Duration(0)
+		for ; played+step <= playtime; played += step {
+			now = now.Add(step)
+			player.Play(step)
+
+			for _, trigger := range s.Triggers {
+				if (played+step)%(time.Duration(trigger.Interval)*time.Minute) == 0 {
+					dropped, err := player.TriggerItemDrop(defs, r, trigger.Item, now)
+					if err != nil {
+						return err
+					}
+
+					if len(dropped) != 0 {
+						if err = record("TriggerItemDrop", now, dropped); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			if s.Missions != nil && (played+step)%(time.Duration(s.Missions.Length)*time.Minute) == 0 {
+				changed, err := s.Missions.play(defs, r, player.Inventory)
+				if err != nil {
+					return err
+				}
+
+				if len(changed) != 0 {
+					if err = record("Mission", now, changed); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		player.Play(playtime - played)
+	}
+
+	return record("Simulate", scenarioStart.AddDate(0, 0, int(s.Days)), nil)
+}
+
+// play rolls the counter events of one mission and adds them to every item
+// in inv that tracks each counter. The items that changed are returned.
+func (m *MissionEvents) play(defs map[int32]*steaminventory.ItemDef, r steaminventory.Roller, inv *steaminventory.Inventory) ([]*steaminventory.ItemInstance, error) {
+	deltas := make([]int64, len(m.Counters))
+	for i, event := range m.Counters {
+		deltas[i] = event.Min + r.Roll(0, event.Max-event.Min+1)
+	}
+
+	var changed []*steaminventory.ItemInstance
+	for _, item := range inv.Items {
+		names := item.CounterNames(defs)
+		if len(names) == 0 {
+			continue
+		}
+
+		tracked := false
+		for i, event := range m.Counters {
+			for _, name := range names {
+				if name != event.Counter {
+					continue
+				}
+
+				if err := item.AddToCounter(names, name, deltas[i], event.Reset); err != nil {
+					return nil, err
+				}
+
+				tracked = true
+
+				break
+			}
+		}
+
+		if tracked {
+			changed = append(changed, item)
+		}
+	}
+
+	return changed, nil
+}
+
+func gcdDuration(a, b time.Duration) time.Duration {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// CounterSummary is the spread of a Strange counter over every item that
+// tracks it at the end of a scenario.
+type CounterSummary struct {
+	Counter string `json:"counter"`
+	Name    string `json:"name,omitempty"`
+	Items   int64  `json:"items"`
+	Total   int64  `json:"total"`
+	Highest int64  `json:"highest"`
+}
+
+// counterTotals adds up the counters of many inventories. It is safe to use
+// from multiple goroutines, and the totals don't depend on the order the
+// inventories are added in.
+type counterTotals struct {
+	sync.Mutex
+
+	counters map[string]*CounterSummary
+}
+
+func (t *counterTotals) add(defs map[int32]*steaminventory.ItemDef, inv *steaminventory.Inventory) {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, item := range inv.Items {
+		for _, name := range item.CounterNames(defs) {
+			if t.counters == nil {
+				t.counters = make(map[string]*CounterSummary)
+			}
+
+			summary, ok := t.counters[name]
+			if !ok {
+				summary = &CounterSummary{Counter: name}
+				t.counters[name] = summary
+			}
+
+			value := item.DynamicProps[name]
+			summary.Items++
+			summary.Total += value
+			if value > summary.Highest {
+				summary.Highest = value
+			}
+		}
+	}
+}
+
+// summaries returns the totals in counter order, named after the mission
+// events that increment them. If missions is nil, the counters never
+// changed and nothing is returned.
+func (t *counterTotals) summaries(missions *MissionEvents) []CounterSummary {
+	if missions == nil {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	result := make([]CounterSummary, 0, len(t.counters))
+	for _, summary := range t.counters {
+		result = append(result, *summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Counter < result[j].Counter
+	})
+
+	for i := range result {
+		for _, event := range missions.Counters {
+			switch result[i].Counter {
+			case event.Counter:
+				result[i].Name = event.Name
+			case event.Counter + steaminventory.BestCounterSuffix:
+				result[i].Name = event.Name + " (best)"
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+var (
+	schemaOnce sync.Once
+	schemaDefs map[int32]*steaminventory.ItemDef
+	schemaErr  error
+)
+
+// testItemDefs loads the item schemas in the repository once for all tests.
+// Tests must not modify the definitions.
+func testItemDefs(t testing.TB) map[int32]*steaminventory.ItemDef {
+	t.Helper()
+
+	schemaOnce.Do(func() {
+		schemaDefs, schemaErr = steaminventory.LoadItemDefs("item-schema-*.json")
+	})
+
+	if schemaErr != nil {
+		t.Fatal(schemaErr)
+	}
+
+	return schemaDefs
+}
+
+// testSchema loads one of the small schemas that the steaminventory tests
+// share, steaminventory/testdata/item-schema-<name>.json.
+func testSchema(t testing.TB, name string) map[int32]*steaminventory.ItemDef {
+	t.Helper()
+
+	defs, err := steaminventory.LoadItemDefs(filepath.Join("steaminventory", "testdata", "item-schema-"+name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return defs
+}
+
+func TestScenarioValidate(t *testing.T) {
+	valid := func() *Scenario {
+		return &Scenario{
+			Players:  1,
+			Days:     1,
+			Playtime: []PlaytimeBucket{{Minutes: 60, Weight: 1}},
+			Pools: []DropPool{
+				{
+					Name:     "pool",
+					Interval: 15,
+					Groups: []DropGroup{
+						{
+							Name:   "group",
+							Weight: 1,
+							Generators: []ScenarioDrop{
+								{Item: 7000, Weight: 1, Remainder: true},
+							},
+						},
+					},
+				},
+			},
+			Triggers: []DropTrigger{{Item: 7021, Interval: 15}},
+			Tokens: &TokenGrant{
+				Item:     4001,
+				Interval: 1,
+				Quantity: 1,
+				Classes:  []ClassUnlock{{Class: "officer", Percent: 50}},
+			},
+			Missions: &MissionEvents{
+				Length: 30,
+				Counters: []CounterEvent{
+					{Counter: "strange_5002", Min: 50, Max: 300},
+					{Counter: "strange_5007", Min: 10, Max: 80, Reset: true},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(s *Scenario)
+		err    string
+	}{
+		{name: "valid", change: func(s *Scenario) {}},
+		{name: "no players", change: func(s *Scenario) { s.Players = 0 }, err: "players must be positive"},
+		{name: "no days", change: func(s *Scenario) { s.Days = 0 }, err: "days must be positive"},
+		{name: "empty playtime", change: func(s *Scenario) { s.Playtime[0].Weight = 0 }, err: "playtime distribution is empty"},
+		{name: "pool interval", change: func(s *Scenario) { s.Pools[0].Interval = 0 }, err: `pool "pool": interval must be positive`},
+		{name: "no remainder", change: func(s *Scenario) { s.Pools[0].Groups[0].Generators[0].Remainder = false }, err: "exactly one remainder"},
+		{name: "trigger interval", change: func(s *Scenario) { s.Triggers[0].Interval = 0 }, err: "interval must be positive"},
+		{name: "token interval", change: func(s *Scenario) { s.Tokens.Interval = 0 }, err: "tokens: interval must be positive"},
+		{name: "token quantity", change: func(s *Scenario) { s.Tokens.Quantity = 0 }, err: "tokens: quantity must be positive"},
+		{name: "negative playtime weight", change: func(s *Scenario) { s.Playtime = append(s.Playtime, PlaytimeBucket{Minutes: 30, Weight: -1}) }, err: "must not be negative"},
+		{name: "unknown trigger", change: func(s *Scenario) { s.Triggers[0].Item = 99999 }, err: "item 99999 does not exist"},
+		{name: "trigger is not a playtimegenerator", change: func(s *Scenario) { s.Triggers[0].Item = 4001 }, err: "not a playtimegenerator"},
+		{name: "unknown generator", change: func(s *Scenario) { s.Pools[0].Groups[0].Generators[0].Item = 99999 }, err: "item 99999 does not exist"},
+		{name: "tag_generator in pool", change: func(s *Scenario) { s.Pools[0].Groups[0].Generators[0].Item = 6001 }, err: "is a tag_generator"},
+		{name: "zero group weight", change: func(s *Scenario) { s.Pools[0].Groups[0].Weight = 0 }, err: "group weights must add up"},
+		{name: "zero generator weights", change: func(s *Scenario) { s.Pools[0].Groups[0].Generators[0].Weight = 0 }, err: "generator weights must add up"},
+		{name: "negative generator weight", change: func(s *Scenario) { s.Pools[0].Groups[0].Generators[0].Weight = -1 }, err: "must not be negative"},
+		{name: "negative daily limit", change: func(s *Scenario) { s.Pools[0].DailyLimit = -1 }, err: "daily_limit must not be negative"},
+		{name: "unknown token", change: func(s *Scenario) { s.Tokens.Item = 99999 }, err: "item 99999 does not exist"},
+		{name: "percent above 100", change: func(s *Scenario) { s.Tokens.Classes[0].Percent = 101 }, err: "between 0 and 100"},
+		{name: "negative percent", change: func(s *Scenario) { s.Tokens.Classes[0].Percent = -1 }, err: "between 0 and 100"},
+		{name: "zero mission length", change: func(s *Scenario) { s.Missions.Length = 0 }, err: "length must be positive"},
+		{name: "missions without items", change: func(s *Scenario) { s.Triggers, s.Tokens = nil, nil }, err: "only tracked for the items"},
+		{name: "unknown counter", change: func(s *Scenario) { s.Missions.Counters[0].Counter = "kills" }, err: "not a counter of any Strange Device"},
+		{name: "best counter", change: func(s *Scenario) { s.Missions.Counters[0].Counter = "strange_5007_best" }, err: "not a counter of any Strange Device"},
+		{name: "min above max", change: func(s *Scenario) { s.Missions.Counters[0].Min = 301 }, err: "min must not be negative or more than max"},
+		{name: "negative min", change: func(s *Scenario) { s.Missions.Counters[0].Min = -1 }, err: "min must not be negative or more than max"},
+	}
+
+	defs := testItemDefs(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.change(s)
+
+			err := s.validate(defs)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadShippedScenarios(t *testing.T) {
+	defs := testItemDefs(t)
+
+	names, err := filepath.Glob("scenarios/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		if _, err := loadScenario(name, defs); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestScenarioPoolDrops(t *testing.T) {
+	s := &Scenario{
+		Players:  10,
+		Days:     1,
+		Playtime: []PlaytimeBucket{{Minutes: 30, Weight: 1}, {Minutes: 60, Weight: 3}},
+		Pools: []DropPool{
+			{
+				Name:       "pool",
+				Interval:   15,
+				DailyLimit: 3,
+				Groups: []DropGroup{
+					{
+						Name:   "group",
+						Weight: 1,
+						Generators: []ScenarioDrop{
+							{Item: 1, Weight: 1},
+							{Item: 2, Weight: 2, Remainder: true},
+							{Item: 3, Weight: 1},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// 10 players for a day, with an average of (2*1 + 3*3) / 4 drops each
+	// (the 60 minute sessions hit the daily limit), split 1:2:1 with the
+	// rounding error going to item 2
+	want := steaminventory.TaggedBundleDefs{{Item: 1, Quantity: 6}, {Item: 2, Quantity: 15}, {Item: 3, Quantity: 6}}
+
+	got := s.poolDrops()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i].Item != want[i].Item || got[i].Quantity != want[i].Quantity {
+			t.Errorf("drop %d is %d x %d, want %d x %d", i, got[i].Quantity, got[i].Item, want[i].Quantity, want[i].Item)
+		}
+	}
+}
+
+// TestStrangeCountersScenario checks the counters of a short run of the
+// shipped Strange counter scenario: every rare counts the missions played
+// since it dropped, and the streak's best is the highest streak.
+func TestStrangeCountersScenario(t *testing.T) {
+	defs := testItemDefs(t)
+
+	s, err := loadScenario("scenarios/strange-counters.json", defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Players = 5
+
+	_, counters, err := s.run(defs, 1, 2, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counters) == 0 {
+		t.Fatal("no counters were reported")
+	}
+
+	missionsPerDay := int64(s.Playtime[0].Minutes / s.Missions.Length)
+
+	for _, counter := range counters {
+		switch counter.Counter {
+		case "strange_5000":
+			if counter.Highest > missionsPerDay*int64(s.Days) {
+				t.Errorf("an item counted %d missions in %d days", counter.Highest, s.Days)
+			}
+		case "strange_5007_best":
+			if counter.Highest > 80 {
+				t.Errorf("best kill streak is %d, more than the most kills in a mission", counter.Highest)
+			}
+		}
+
+		if counter.Items == 0 || counter.Total < 0 {
+			t.Errorf("counter %s: %+v", counter.Counter, counter)
+		}
+	}
+}
+
+// BenchmarkReactiveDropDaily runs the shipped daily drop scenario on one
+// worker, rolling the drop pools both ways.
+func BenchmarkReactiveDropDaily(b *testing.B) {
+	defs := testItemDefs(b)
+
+	s, err := loadScenario("scenarios/reactive-drop-daily.json", defs)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, batch := range []bool{true, false} {
+		name := "per-unit"
+		if batch {
+			name = "batch"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, _, err := s.run(defs, int64(i), 1, batch, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMissionEventsPlay(t *testing.T) {
+	tests := []struct {
+		name     string
+		counters []CounterEvent
+		missions int
+		want     map[string]int64
+	}{
+		{
+			name:     "missions",
+			counters: []CounterEvent{{Counter: "missions", Min: 1, Max: 1}},
+			missions: 3,
+			want:     map[string]int64{"missions": 3, "streak": 0, "streak_best": 0},
+		},
+		{
+			name:     "streak",
+			counters: []CounterEvent{{Counter: "streak", Min: 4, Max: 4}},
+			missions: 3,
+			want:     map[string]int64{"missions": 0, "streak": 12, "streak_best": 12},
+		},
+		{
+			name:     "reset streak",
+			counters: []CounterEvent{{Counter: "streak", Min: 4, Max: 4, Reset: true}},
+			missions: 3,
+			want:     map[string]int64{"missions": 0, "streak": 4, "streak_best": 4},
+		},
+		{
+			name:     "untracked counter",
+			counters: []CounterEvent{{Counter: "kills", Min: 1, Max: 1}},
+			missions: 2,
+			want:     map[string]int64{"missions": 0, "streak": 0, "streak_best": 0},
+		},
+	}
+
+	defs := testSchema(t, "counters")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := steaminventory.NewInventory(&steaminventory.ItemIDAllocator{})
+			inv.Grant(defs, steaminventory.TaggedBundleDefs{{Item: 1, Quantity: 1, Tags: steaminventory.KeyValuePairs{{Key: "strange", Value: "10"}, {Key: "strange", Value: "11"}}}}, scenarioStart, steaminventory.OriginExternal)
+
+			m := &MissionEvents{Length: 30, Counters: tt.counters}
+			for i := 0; i < tt.missions; i++ {
+				if _, err := m.play(defs, steaminventory.NewRoller(1), inv); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := inv.Items[0].DynamicProps; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounterTotals(t *testing.T) {
+	defs := testSchema(t, "counters")
+
+	var totals counterTotals
+	for _, missions := range []int64{3, 5} {
+		inv := steaminventory.NewInventory(&steaminventory.ItemIDAllocator{})
+		inv.Grant(defs, steaminventory.TaggedBundleDefs{{Item: 1, Quantity: 1, Tags: steaminventory.KeyValuePairs{{Key: "strange", Value: "11"}}}}, scenarioStart, steaminventory.OriginExternal)
+
+		if err := inv.Items[0].IncrementCounter(defs, "streak", missions); err != nil {
+			t.Fatal(err)
+		}
+
+		totals.add(defs, inv)
+	}
+
+	if got := totals.summaries(nil); got != nil {
+		t.Errorf("got %v without missions, want nothing", got)
+	}
+
+	got := totals.summaries(&MissionEvents{Counters: []CounterEvent{{Counter: "streak", Name: "Streak"}}})
+	want := []CounterSummary{
+		{Counter: "streak", Name: "Streak", Items: 2, Total: 8, Highest: 5},
+		{Counter: "streak_best", Name: "Streak (best)", Items: 2, Total: 8, Highest: 5},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
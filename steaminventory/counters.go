@@ -0,0 +1,115 @@
+package steaminventory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BestCounterSuffix marks a counter that holds the highest value reached by
+// the counter with the same name without the suffix.
+const BestCounterSuffix = "_best"
+
+type UnknownCounterError struct {
+	ItemID  uint64
+	Item    int32
+	Counter string
+}
+
+func (e *UnknownCounterError) Error() string {
+	return fmt.Sprintf("item %d (#%d) has no attached device that tracks %s", e.ItemID, e.Item, e.Counter)
+}
+
+// CounterNames returns the counters an item instance has: the dynamic
+// properties declared by the tag tools attached to it.
+func (item *ItemInstance) CounterNames(defs map[int32]*ItemDef) []string {
+	var names []string
+	for _, tool := range attachedTools(defs, defs[item.Item], item.Tags) {
+		names = append(names, tool.CompressedDynamicProps...)
+	}
+
+	return names
+}
+
+// HasCounter returns true if a tag tool attached to the item tracks name.
+func (item *ItemInstance) HasCounter(defs map[int32]*ItemDef, name string) bool {
+	return containsString(item.CounterNames(defs), name)
+}
+
+// initCounters sets every counter of the item that isn't set yet to 0.
+func (item *ItemInstance) initCounters(defs map[int32]*ItemDef) {
+	item.initCounterNames(item.CounterNames(defs))
+}
+
+func (item *ItemInstance) initCounterNames(names []string) {
+	for _, name := range names {
+		if _, ok := item.DynamicProps[name]; ok {
+			continue
+		}
+
+		if item.DynamicProps == nil {
+			item.DynamicProps = make(map[string]int64)
+		}
+
+		item.DynamicProps[name] = 0
+	}
+}
+
+// IncrementCounter adds delta to a counter of the item. If the counter has
+// a _best counter, that is raised to the new value if it is higher.
+func (item *ItemInstance) IncrementCounter(defs map[int32]*ItemDef, name string, delta int64) error {
+	return item.AddToCounter(item.CounterNames(defs), name, delta, false)
+}
+
+// resetCounter sets a counter of the item back to 0, keeping its _best
+// counter. It is used for counters like kill streaks.
+func (item *ItemInstance) resetCounter(defs map[int32]*ItemDef, name string) error {
+	return item.AddToCounter(item.CounterNames(defs), name, 0, true)
+}
+
+// AddToCounter does the work of IncrementCounter and resetCounter for an
+// item with the given counters, so that callers updating many counters only
+// look up the attached tools once.
+func (item *ItemInstance) AddToCounter(names []string, name string, delta int64, reset bool) error {
+	if strings.HasSuffix(name, BestCounterSuffix) || !containsString(names, name) {
+		return &UnknownCounterError{
+			ItemID:  item.ItemID,
+			Item:    item.Item,
+			Counter: name,
+		}
+	}
+
+	item.initCounterNames(names)
+	if reset {
+		item.DynamicProps[name] = 0
+	}
+
+	item.DynamicProps[name] += delta
+
+	best := name + BestCounterSuffix
+	if containsString(names, best) && item.DynamicProps[name] > item.DynamicProps[best] {
+		item.DynamicProps[best] = item.DynamicProps[name]
+	}
+
+	return nil
+}
+
+// incrementCounter adds delta to a counter of the item with the given item
+// ID.
+func (inv *Inventory) incrementCounter(defs map[int32]*ItemDef, itemID uint64, name string, delta int64) error {
+	item := inv.Find(itemID)
+	if item == nil {
+		return &ItemNotFoundError{ItemID: itemID}
+	}
+
+	return item.IncrementCounter(defs, name, delta)
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
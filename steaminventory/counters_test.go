@@ -0,0 +1,108 @@
+package steaminventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAddToCounter(t *testing.T) {
+	type step struct {
+		counter string
+		delta   int64
+		reset   bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+		want  map[string]int64
+		err   bool
+	}{
+		{
+			name:  "increment",
+			steps: []step{{counter: "missions", delta: 1}, {counter: "missions", delta: 2}},
+			want:  map[string]int64{"missions": 3, "streak": 0, "streak_best": 0},
+		},
+		{
+			name:  "best follows the highest value",
+			steps: []step{{counter: "streak", delta: 5}, {counter: "streak", reset: true}, {counter: "streak", delta: 3}},
+			want:  map[string]int64{"missions": 0, "streak": 3, "streak_best": 5},
+		},
+		{
+			name:  "reset then add",
+			steps: []step{{counter: "streak", delta: 5}, {counter: "streak", delta: 7, reset: true}},
+			want:  map[string]int64{"missions": 0, "streak": 7, "streak_best": 7},
+		},
+		{
+			name:  "best can't be changed directly",
+			steps: []step{{counter: "streak_best", delta: 1}},
+			err:   true,
+		},
+		{
+			name:  "unknown counter",
+			steps: []step{{counter: "kills", delta: 1}},
+			err:   true,
+		},
+	}
+
+	defs := testSchema(t, "counters")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &ItemInstance{ItemID: 1, Item: 1, Tags: KeyValuePairs{{"strange", "10"}, {"strange", "11"}}}
+			names := item.CounterNames(defs)
+
+			var err error
+			for _, s := range tt.steps {
+				if err = item.AddToCounter(names, s.counter, s.delta, s.reset); err != nil {
+					break
+				}
+			}
+
+			if tt.err {
+				var unknown *UnknownCounterError
+				if !errors.As(err, &unknown) {
+					t.Fatalf("got error %v, want an UnknownCounterError", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(item.DynamicProps, tt.want) {
+				t.Errorf("got %v, want %v", item.DynamicProps, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrantInitsCounters(t *testing.T) {
+	defs := testSchema(t, "counters")
+	inv := NewInventory(&ItemIDAllocator{})
+
+	granted := inv.Grant(defs, TaggedBundleDefs{
+		{Item: 1, Quantity: 1, Tags: KeyValuePairs{{"strange", "11"}}},
+		{Item: 1, Quantity: 1},
+	}, testTime, OriginExternal)
+
+	if want := map[string]int64{"streak": 0, "streak_best": 0}; !reflect.DeepEqual(granted[0].DynamicProps, want) {
+		t.Errorf("item with a device has counters %v, want %v", granted[0].DynamicProps, want)
+	}
+
+	if granted[1].DynamicProps != nil {
+		t.Errorf("item without a device has counters %v", granted[1].DynamicProps)
+	}
+
+	if err := inv.incrementCounter(defs, granted[0].ItemID, "streak", 2); err != nil {
+		t.Error(err)
+	}
+
+	var notFound *ItemNotFoundError
+	if err := inv.incrementCounter(defs, 12345, "streak", 1); !errors.As(err, &notFound) {
+		t.Errorf("got error %v, want an ItemNotFoundError", err)
+	}
+}
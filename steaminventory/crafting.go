@@ -0,0 +1,540 @@
+package steaminventory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type MissingMaterialsError struct {
+	Target int32
+
+	// shortfall for each of the target's recipes, in schema order
+	Missing []ExchangeRecipe
+}
+
+func (e *MissingMaterialsError) Error() string {
+	if len(e.Missing) == 0 {
+		return fmt.Sprintf("item %d cannot be crafted", e.Target)
+	}
+
+	recipes := make([]string, len(e.Missing))
+	for i, missing := range e.Missing {
+		recipes[i] = fmt.Sprintf("recipe %d needs %s", i+1, formatExchangeRecipe(missing))
+	}
+
+	return fmt.Sprintf("cannot craft item %d: %s", e.Target, strings.Join(recipes, "; "))
+}
+
+// CraftItem exchanges materials from inventory for one of target using the
+// first recipe the inventory satisfies. The inventory is not modified; the
+// updated inventory is returned.
+func CraftItem(defs map[int32]*ItemDef, inventory TaggedBundleDefs, target int32) (TaggedBundleDefs, error) {
+	def, ok := defs[target]
+	if !ok {
+		return nil, fmt.Errorf("cannot craft unknown item %d", target)
+	}
+
+	missing := make([]ExchangeRecipe, 0, len(def.Exchange))
+	for _, recipe := range def.Exchange {
+		remaining, short := consumeMaterials(defs, inventory, recipe)
+		if len(short) != 0 {
+			missing = append(missing, short)
+
+			continue
+		}
+
+		var result ItemAggregator
+		result.AddAll(remaining)
+		result.add(target, 1, nil)
+
+		return result.Items, nil
+	}
+
+	return nil, &MissingMaterialsError{
+		Target:  target,
+		Missing: missing,
+	}
+}
+
+// consumeMaterials removes the inputs of recipe from a copy of inventory.
+// If the inventory doesn't have enough materials, the inputs that couldn't
+// be satisfied are returned instead.
+func consumeMaterials(defs map[int32]*ItemDef, inventory TaggedBundleDefs, recipe ExchangeRecipe) (TaggedBundleDefs, ExchangeRecipe) {
+	remaining, short := matchRecipe(defs, recipe, inventory)
+	if len(short) != 0 {
+		return nil, short
+	}
+
+	// drop emptied stacks
+	var kept TaggedBundleDefs
+	for i, item := range inventory {
+		if remaining[i] != 0 {
+			item.Quantity = remaining[i]
+			kept = append(kept, item)
+		}
+	}
+
+	return kept, nil
+}
+
+// matchRecipe takes the inputs of recipe from items and returns the
+// quantity left of each item. If the items don't satisfy the recipe, the
+// inputs that are still needed are returned as well. items is not
+// modified.
+//
+// An item can match more than one input, like an item that is both listed
+// by itemdefid and has a listed tag, so the items are assigned to the
+// inputs as a maximum flow: whenever an input can't find an unused item,
+// the inputs that took the items it matches are moved to other items if
+// they can be.
+func matchRecipe(defs map[int32]*ItemDef, recipe ExchangeRecipe, items TaggedBundleDefs) ([]int64, ExchangeRecipe) {
+	remaining := make([]int64, len(items))
+	for i, item := range items {
+		remaining[i] = item.Quantity
+	}
+
+	need := make([]int64, len(recipe))
+	matches := make([][]bool, len(recipe))
+	taken := make([][]int64, len(recipe))
+	for i, input := range recipe {
+		need[i] = int64(input.Quantity)
+		matches[i] = make([]bool, len(items))
+		taken[i] = make([]int64, len(items))
+
+		for j, item := range items {
+			matches[i][j] = exchangeInputMatches(defs, input, item.Item, item.Tags)
+		}
+	}
+
+	const (
+		unvisited = -2
+		start     = -1
+	)
+
+	for {
+		// breadth-first search for an item with some left, starting from
+		// the inputs that still need more. fromInput[j] is the input that
+		// reached item j, and fromItem[i] is the item that input i could
+		// give back so that another input can take it instead.
+		fromInput := make([]int, len(items))
+		for j := range fromInput {
+			fromInput[j] = -1
+		}
+
+		fromItem := make([]int, len(recipe))
+		var queue []int
+		for i := range recipe {
+			fromItem[i] = unvisited
+			if need[i] != 0 {
+				fromItem[i] = start
+				queue = append(queue, i)
+			}
+		}
+
+		found := -1
+		for len(queue) != 0 && found == -1 {
+			i := queue[0]
+			queue = queue[1:]
+
+			for j := range items {
+				if !matches[i][j] || fromInput[j] != -1 {
+					continue
+				}
+
+				fromInput[j] = i
+				if remaining[j] != 0 {
+					found = j
+
+					break
+				}
+
+				for k := range recipe {
+					if fromItem[k] == unvisited && taken[k][j] != 0 {
+						fromItem[k] = j
+						queue = append(queue, k)
+					}
+				}
+			}
+		}
+
+		if found == -1 {
+			break
+		}
+
+		amount := remaining[found]
+		for j := found; ; {
+			i := fromInput[j]
+			if fromItem[i] == start {
+				if amount > need[i] {
+					amount = need[i]
+				}
+
+				break
+			}
+
+			if amount > taken[i][fromItem[i]] {
+				amount = taken[i][fromItem[i]]
+			}
+
+			j = fromItem[i]
+		}
+
+		remaining[found] -= amount
+		for j := found; ; {
+			i := fromInput[j]
+			taken[i][j] += amount
+			if fromItem[i] == start {
+				need[i] -= amount
+
+				break
+			}
+
+			taken[i][fromItem[i]] -= amount
+			j = fromItem[i]
+		}
+	}
+
+	var short ExchangeRecipe
+	for i, input := range recipe {
+		if need[i] != 0 {
+			input.Quantity = int32(need[i])
+			short = append(short, input)
+		}
+	}
+
+	return remaining, short
+}
+
+// exchangeInputMatches returns true if an item with the given itemdefid and
+// instance tags can be used for input.
+func exchangeInputMatches(defs map[int32]*ItemDef, input ExchangeInput, id int32, tags KeyValuePairs) bool {
+	if input.Item != 0 {
+		return input.Item == id
+	}
+
+	for _, kv := range defs[id].Tags {
+		if kv == input.Tag {
+			return true
+		}
+	}
+
+	for _, kv := range tags {
+		if kv == input.Tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CraftingCost returns the base materials needed to craft quantity of
+// target, following the first recipe of every material that can itself be
+// crafted. The quantities are added up in int64, and an error is returned
+// if any of them don't fit in a recipe's int32.
+func CraftingCost(defs map[int32]*ItemDef, target int32, quantity int32) (ExchangeRecipe, error) {
+	if _, ok := defs[target]; !ok {
+		return nil, fmt.Errorf("cannot craft unknown item %d", target)
+	}
+
+	var cost ExchangeRecipe
+	var totals []int64
+
+	var visit func(id int32, quantity int64, path []int32) error
+	visit = func(id int32, quantity int64, path []int32) error {
+		for _, p := range path {
+			if p == id {
+				return fmt.Errorf("crafting cycle: recipe for item %d requires itself", id)
+			}
+		}
+
+		def := defs[id]
+		if len(def.Exchange) == 0 {
+			return fmt.Errorf("item %d cannot be crafted", id)
+		}
+
+		path = append(path, id)
+
+		for _, input := range def.Exchange[0] {
+			// both factors fit in int32, so the product fits in int64
+			needed := int64(input.Quantity) * quantity
+			if needed > math.MaxInt32 {
+				return craftingCostOverflow(input, needed)
+			}
+
+			if input.Item != 0 && len(defs[input.Item].Exchange) != 0 {
+				err := visit(input.Item, needed, path)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			i := exchangeInputIndex(cost, input)
+			if i == len(cost) {
+				cost = append(cost, input)
+				totals = append(totals, 0)
+			}
+
+			totals[i] += needed
+			if totals[i] > math.MaxInt32 {
+				return craftingCostOverflow(input, totals[i])
+			}
+
+			cost[i].Quantity = int32(totals[i])
+		}
+
+		return nil
+	}
+
+	err := visit(target, int64(quantity), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return cost, nil
+}
+
+var errCraftingCostOverflow = errors.New("crafting cost does not fit in an int32")
+
+// craftingCostOverflow returns an error for needing quantity of input.
+func craftingCostOverflow(input ExchangeInput, quantity int64) error {
+	if input.Item != 0 {
+		return fmt.Errorf("%w: needs %d of item %d", errCraftingCostOverflow, quantity, input.Item)
+	}
+
+	return fmt.Errorf("%w: needs %d of items tagged %s:%s", errCraftingCostOverflow, quantity, input.Tag.Key, input.Tag.Value)
+}
+
+// exchangeInputIndex returns the index of the input in recipe with the same
+// itemdefid or tag as input, or len(recipe) if there isn't one.
+func exchangeInputIndex(recipe ExchangeRecipe, input ExchangeInput) int {
+	for i := range recipe {
+		if recipe[i].Item == input.Item && recipe[i].Tag == input.Tag {
+			return i
+		}
+	}
+
+	return len(recipe)
+}
+
+func formatExchangeRecipe(recipe ExchangeRecipe) string {
+	inputs := make([]string, len(recipe))
+	for i, input := range recipe {
+		if input.Item != 0 {
+			inputs[i] = fmt.Sprintf("%dx item %d", input.Quantity, input.Item)
+		} else {
+			inputs[i] = fmt.Sprintf("%dx item tagged %s:%s", input.Quantity, input.Tag.Key, input.Tag.Value)
+		}
+	}
+
+	return strings.Join(inputs, ", ")
+}
+
+// ExchangeMaterial is an amount of an item instance offered for an
+// exchange.
+type ExchangeMaterial struct {
+	ItemID   uint64
+	Quantity int32
+}
+
+var errNoMatchingRecipe = errors.New("materials do not match any exchange recipe")
+
+// exchangeItems consumes materials from the inventory and grants one of
+// target, expanded with GenerateItems. Like Steam's ExchangeItem, the
+// materials must satisfy one of target's recipes exactly, with nothing
+// left over. The created items are returned first, followed by the
+// materials with their remaining quantities.
+func (inv *Inventory) exchangeItems(defs map[int32]*ItemDef, materials []ExchangeMaterial, target int32, r Roller, now time.Time) ([]*ItemInstance, error) {
+	def, ok := defs[target]
+	if !ok {
+		return nil, fmt.Errorf("cannot exchange for unknown item %d", target)
+	}
+
+	items := make([]*ItemInstance, len(materials))
+	quantities := make([]int32, len(materials))
+	used := make(map[uint64]int64)
+	for i, m := range materials {
+		items[i] = inv.Find(m.ItemID)
+		if items[i] == nil {
+			return nil, &ItemNotFoundError{ItemID: m.ItemID}
+		}
+
+		// added up in int64 so that offering the same item twice can't
+		// overflow
+		used[m.ItemID] += int64(m.Quantity)
+		if m.Quantity <= 0 || used[m.ItemID] > int64(items[i].Quantity) {
+			return nil, &InsufficientQuantityError{
+				ItemID:   m.ItemID,
+				Quantity: items[i].Quantity,
+				Needed:   used[m.ItemID],
+			}
+		}
+
+		quantities[i] = m.Quantity
+	}
+
+	matched := false
+	for _, recipe := range def.Exchange {
+		if recipeMatchesExactly(defs, recipe, items, quantities) {
+			matched = true
+
+			break
+		}
+	}
+
+	if !matched {
+		return nil, fmt.Errorf("cannot exchange for item %d: %w", target, errNoMatchingRecipe)
+	}
+
+	generated, err := GenerateItems(defs, TaggedBundleDefs{{Item: target, Quantity: 1}}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []InventoryEvent
+	for i, item := range items {
+		events = append(events, InventoryEvent{
+			Time:     now,
+			Action:   EventConsumed,
+			ItemID:   item.ItemID,
+			Item:     item.Item,
+			Quantity: quantities[i],
+			Tags:     append(KeyValuePairs(nil), item.Tags...),
+			Props:    copyProps(item.DynamicProps),
+		})
+
+		if err := inv.Consume(item.ItemID, quantities[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	created := inv.Grant(defs, generated, now, OriginExchange)
+	for _, item := range created {
+		events = append(events, InventoryEvent{
+			Time:     now,
+			Action:   EventCreated,
+			ItemID:   item.ItemID,
+			Item:     item.Item,
+			Quantity: item.Quantity,
+			Tags:     append(KeyValuePairs(nil), item.Tags...),
+		})
+	}
+
+	inv.Events = append(inv.Events, events...)
+
+	return append(created, items...), nil
+}
+
+// Exchange is ExchangeItem for the Web API and the client. An exchange for
+// a Strange Device that offers one extraction tool and one host item is
+// done by extractDevice, and an exchange of one token like the Strange Item
+// Token is done by redeemToken with the player's classes; anything else,
+// including other recipes that take a single item, is done by
+// exchangeItems. The created items are returned first, followed by
+// the materials.
+func (p *SimulatedPlayer) Exchange(defs map[int32]*ItemDef, materials []ExchangeMaterial, target int32, r Roller, now time.Time) ([]*ItemInstance, error) {
+	inv := p.Inventory
+
+	if tool, host := inv.extractionMaterials(defs, materials, target); tool != nil {
+		events, err := inv.extractDevice(defs, tool.ItemID, host.ItemID, target, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(createdItems(inv, events), tool, host), nil
+	}
+
+	if token := inv.tokenMaterial(defs, materials, target); token != nil {
+		events, err := inv.redeemToken(defs, token.ItemID, target, p.Classes, r, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(createdItems(inv, events), token), nil
+	}
+
+	return inv.exchangeItems(defs, materials, target, r, now)
+}
+
+// createdItems returns the instances of the items created by events.
+func createdItems(inv *Inventory, events []InventoryEvent) []*ItemInstance {
+	var created []*ItemInstance
+	for _, event := range events {
+		if event.Action == EventCreated {
+			created = append(created, inv.Find(event.ItemID))
+		}
+	}
+
+	return created
+}
+
+// tokenMaterial returns the token if materials are one of a token, as
+// defined by isToken, that the target has a recipe for. Otherwise, it
+// returns nil.
+func (inv *Inventory) tokenMaterial(defs map[int32]*ItemDef, materials []ExchangeMaterial, target int32) *ItemInstance {
+	def, ok := defs[target]
+	if !ok || len(materials) != 1 || materials[0].Quantity != 1 {
+		return nil
+	}
+
+	token := inv.Find(materials[0].ItemID)
+	if token == nil || !hasTokenRecipe(def, token.Item) || !isToken(defs, token.Item) {
+		return nil
+	}
+
+	return token
+}
+
+// extractionMaterials returns the tool and the host if materials are one
+// of each for a recipe of the target device like "4000,strange:5000", in
+// either order. Otherwise, it returns nil.
+func (inv *Inventory) extractionMaterials(defs map[int32]*ItemDef, materials []ExchangeMaterial, target int32) (tool, host *ItemInstance) {
+	def, ok := defs[target]
+	if !ok || def.Type != "tag_tool" || len(materials) != 2 || materials[0].Quantity != 1 || materials[1].Quantity != 1 {
+		return nil, nil
+	}
+
+	for _, order := range [][2]int{{0, 1}, {1, 0}} {
+		tool = inv.Find(materials[order[0]].ItemID)
+		host = inv.Find(materials[order[1]].ItemID)
+		if tool == nil || host == nil || tool == host {
+			continue
+		}
+
+		if hasExtractionRecipe(def, tool, defs[host.Item].AccessoryTag) {
+			return tool, host
+		}
+	}
+
+	return nil, nil
+}
+
+// recipeMatchesExactly returns true if the given quantities of items
+// satisfy every input of recipe with nothing left over.
+func recipeMatchesExactly(defs map[int32]*ItemDef, recipe ExchangeRecipe, items []*ItemInstance, quantities []int32) bool {
+	offered := make(TaggedBundleDefs, len(items))
+	for i, item := range items {
+		offered[i] = TaggedBundleDef{
+			Item:     item.Item,
+			Quantity: int64(quantities[i]),
+			Tags:     item.Tags,
+		}
+	}
+
+	remaining, short := matchRecipe(defs, recipe, offered)
+	if len(short) != 0 {
+		return false
+	}
+
+	for _, q := range remaining {
+		if q != 0 {
+			return false
+		}
+	}
+
+	return true
+}
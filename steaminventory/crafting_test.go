@@ -0,0 +1,190 @@
+package steaminventory
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCraftItem(t *testing.T) {
+	tests := []struct {
+		name      string
+		inventory TaggedBundleDefs
+		target    int32
+		want      TaggedBundleDefs
+		missing   []ExchangeRecipe
+		err       bool
+	}{
+		{
+			name:      "exact",
+			inventory: TaggedBundleDefs{{Item: 1, Quantity: 2}, {Item: 2, Quantity: 1}},
+			target:    3,
+			want:      TaggedBundleDefs{{Item: 3, Quantity: 1}},
+		},
+		{
+			name:      "leftovers",
+			inventory: TaggedBundleDefs{{Item: 1, Quantity: 5}, {Item: 2, Quantity: 1}},
+			target:    3,
+			want:      TaggedBundleDefs{{Item: 1, Quantity: 3}, {Item: 3, Quantity: 1}},
+		},
+		{
+			name:      "instance tag",
+			inventory: TaggedBundleDefs{{Item: 3, Quantity: 1}, {Item: 1, Quantity: 1, Tags: KeyValuePairs{{"color", "red"}}}},
+			target:    4,
+			want:      TaggedBundleDefs{{Item: 4, Quantity: 1}},
+		},
+		{
+			name:      "tag matches an item listed later",
+			inventory: TaggedBundleDefs{{Item: 2, Quantity: 1}, {Item: 1, Quantity: 1, Tags: KeyValuePairs{{"color", "red"}}}},
+			target:    7,
+			want:      TaggedBundleDefs{{Item: 7, Quantity: 1}},
+		},
+		{
+			name:      "tag and item need separate items",
+			inventory: TaggedBundleDefs{{Item: 2, Quantity: 1}},
+			target:    7,
+			missing:   []ExchangeRecipe{{{Item: 2, Quantity: 1}}},
+		},
+		{
+			name:      "missing",
+			inventory: TaggedBundleDefs{{Item: 1, Quantity: 1}},
+			target:    3,
+			missing:   []ExchangeRecipe{{{Item: 1, Quantity: 1}, {Item: 2, Quantity: 1}}},
+		},
+		{
+			name:   "unknown item",
+			target: 99999,
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CraftItem(testSchema(t, "crafting"), tt.inventory, tt.target)
+
+			var missing *MissingMaterialsError
+			switch {
+			case tt.missing != nil:
+				if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Missing, tt.missing) {
+					t.Fatalf("got error %v, want missing %v", err, tt.missing)
+				}
+			case tt.err:
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCraftingCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   int32
+		quantity int32
+		want     ExchangeRecipe
+		err      bool
+		overflow bool
+	}{
+		{
+			name:     "one level",
+			target:   3,
+			quantity: 2,
+			want:     ExchangeRecipe{{Item: 1, Quantity: 4}, {Item: 2, Quantity: 2}},
+		},
+		{
+			name:     "nested",
+			target:   4,
+			quantity: 1,
+			want:     ExchangeRecipe{{Item: 1, Quantity: 2}, {Item: 2, Quantity: 1}, {Tag: KeyValuePair{"color", "red"}, Quantity: 1}},
+		},
+		{
+			name:     "same material twice",
+			target:   9,
+			quantity: 3,
+			want:     ExchangeRecipe{{Item: 1, Quantity: 6}},
+		},
+		{name: "quantity overflows", target: 3, quantity: math.MaxInt32, overflow: true},
+		{name: "total overflows", target: 9, quantity: 1 << 30, overflow: true},
+		{name: "not craftable", target: 1, quantity: 1, err: true},
+		{name: "cycle", target: 5, quantity: 1, err: true},
+		{name: "unknown item", target: 99999, quantity: 1, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CraftingCost(testSchema(t, "crafting"), tt.target, tt.quantity)
+			if tt.overflow {
+				if !errors.Is(err, errCraftingCostOverflow) {
+					t.Fatalf("got %v, %v, want an overflow error", got, err)
+				}
+
+				return
+			}
+
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeItems(t *testing.T) {
+	// materials are indexes into the inventory, which holds three of item 1
+	// followed by one of item 2
+	tests := []struct {
+		name      string
+		materials []int
+		err       error
+	}{
+		{name: "exact", materials: []int{0, 1, 3}},
+		{name: "leftover", materials: []int{0, 1, 2, 3}, err: errNoMatchingRecipe},
+		{name: "short", materials: []int{0, 3}, err: errNoMatchingRecipe},
+		{name: "wrong item", materials: []int{0, 1, 2}, err: errNoMatchingRecipe},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := testSchema(t, "crafting")
+			inv := NewInventory(&ItemIDAllocator{})
+			inv.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: 3}, {Item: 2, Quantity: 1}}, testTime, OriginExternal)
+
+			materials := make([]ExchangeMaterial, len(tt.materials))
+			for i, m := range tt.materials {
+				materials[i] = ExchangeMaterial{ItemID: inv.Items[m].ItemID, Quantity: 1}
+			}
+
+			_, err := inv.exchangeItems(defs, materials, 3, NewRoller(1), testTime.Add(time.Hour))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			want := 4
+			if tt.err == nil {
+				want = 2
+			}
+
+			if len(inv.Items) != want {
+				t.Errorf("inventory has %d items after the exchange, want %d", len(inv.Items), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,612 @@
+package steaminventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadItemDefs loads every schema file matching pattern. If pattern is a
+// directory, the item-schema-*.json files in that directory are loaded.
+func LoadItemDefs(pattern string) (map[int32]*ItemDef, error) {
+	defs, _, err := LoadSchemaFiles(pattern)
+
+	return defs, err
+}
+
+// SchemaFile is the metadata of an item schema file.
+type SchemaFile struct {
+	Name  string
+	AppID int32
+	Items []int32
+
+	// game-specific fields; these will vary per game
+	TranslatorNote string
+}
+
+// LoadSchemaFiles works like LoadItemDefs, but also returns the metadata of
+// each file.
+func LoadSchemaFiles(pattern string) (map[int32]*ItemDef, []*SchemaFile, error) {
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		pattern = filepath.Join(pattern, "item-schema-*.json")
+	}
+
+	names, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("no item schemas match %q", pattern)
+	}
+
+	defs := make(map[int32]*ItemDef)
+	files := make([]*SchemaFile, len(names))
+
+	for i, name := range names {
+		files[i], err = loadItemDefsFromFile(defs, name)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = validateItemDefs(defs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return defs, files, nil
+}
+
+func loadItemDefsFromFile(defs map[int32]*ItemDef, name string) (*SchemaFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data struct {
+		AppID int32      `json:"appid"`
+		Items []*ItemDef `json:"items"`
+
+		// game-specific fields; these will vary per game
+		TranslatorNote string `json:"translator_note"`
+	}
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	file := &SchemaFile{
+		Name:           name,
+		AppID:          data.AppID,
+		TranslatorNote: data.TranslatorNote,
+	}
+
+	for _, item := range data.Items {
+		if other, ok := defs[item.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate item id %d (also defined in %s)", name, item.ID, other.File)
+		}
+
+		item.File = name
+		defs[item.ID] = item
+		file.Items = append(file.Items, item.ID)
+	}
+
+	return file, nil
+}
+
+type ItemDef struct {
+	ID   int32  `json:"itemdefid"`
+	Type string `json:"type"`
+
+	// use the Localized methods to get a translation with Steam's fallbacks
+	Name                  string `json:"name,omitempty"`
+	NameBrazilian         string `json:"name_brazilian,omitempty"`
+	NameCzech             string `json:"name_czech,omitempty"`
+	NameDanish            string `json:"name_danish,omitempty"`
+	NameDutch             string `json:"name_dutch,omitempty"`
+	NameEnglish           string `json:"name_english,omitempty"`
+	NameFinnish           string `json:"name_finnish,omitempty"`
+	NameFrench            string `json:"name_french,omitempty"`
+	NameGerman            string `json:"name_german,omitempty"`
+	NameHungarian         string `json:"name_hungarian,omitempty"`
+	NameItalian           string `json:"name_italian,omitempty"`
+	NameJapanese          string `json:"name_japanese,omitempty"`
+	NameKoreanA           string `json:"name_koreana,omitempty"`
+	NameNorwegian         string `json:"name_norwegian,omitempty"`
+	NamePolish            string `json:"name_polish,omitempty"`
+	NamePortuguese        string `json:"name_portuguese,omitempty"`
+	NameRomanian          string `json:"name_romanian,omitempty"`
+	NameRussian           string `json:"name_russian,omitempty"`
+	NameSChinese          string `json:"name_schinese,omitempty"`
+	NameSpanish           string `json:"name_spanish,omitempty"`
+	NameSwedish           string `json:"name_swedish,omitempty"`
+	NameTChinese          string `json:"name_tchinese,omitempty"`
+	NameThai              string `json:"name_thai,omitempty"`
+	NameTurkish           string `json:"name_turkish,omitempty"`
+	NameUkrainian         string `json:"name_ukrainian,omitempty"`
+	Description           string `json:"description,omitempty"`
+	DescriptionBrazilian  string `json:"description_brazilian,omitempty"`
+	DescriptionCzech      string `json:"description_czech,omitempty"`
+	DescriptionDanish     string `json:"description_danish,omitempty"`
+	DescriptionDutch      string `json:"description_dutch,omitempty"`
+	DescriptionEnglish    string `json:"description_english,omitempty"`
+	DescriptionFinnish    string `json:"description_finnish,omitempty"`
+	DescriptionFrench     string `json:"description_french,omitempty"`
+	DescriptionGerman     string `json:"description_german,omitempty"`
+	DescriptionHungarian  string `json:"description_hungarian,omitempty"`
+	DescriptionItalian    string `json:"description_italian,omitempty"`
+	DescriptionJapanese   string `json:"description_japanese,omitempty"`
+	DescriptionKoreanA    string `json:"description_koreana,omitempty"`
+	DescriptionNorwegian  string `json:"description_norwegian,omitempty"`
+	DescriptionPolish     string `json:"description_polish,omitempty"`
+	DescriptionPortuguese string `json:"description_portuguese,omitempty"`
+	DescriptionRomanian   string `json:"description_romanian,omitempty"`
+	DescriptionRussian    string `json:"description_russian,omitempty"`
+	DescriptionSChinese   string `json:"description_schinese,omitempty"`
+	DescriptionSpanish    string `json:"description_spanish,omitempty"`
+	DescriptionSwedish    string `json:"description_swedish,omitempty"`
+	DescriptionTChinese   string `json:"description_tchinese,omitempty"`
+	DescriptionThai       string `json:"description_thai,omitempty"`
+	DescriptionTurkish    string `json:"description_turkish,omitempty"`
+	DescriptionUkrainian  string `json:"description_ukrainian,omitempty"`
+	DisplayType           string `json:"display_type,omitempty"`
+	DisplayTypeEnglish    string `json:"display_type_english,omitempty"`
+	DisplayTypeGerman     string `json:"display_type_german,omitempty"`
+	DisplayTypeItalian    string `json:"display_type_italian,omitempty"`
+	DisplayTypeJapanese   string `json:"display_type_japanese,omitempty"`
+	DisplayTypeRussian    string `json:"display_type_russian,omitempty"`
+
+	IconURL         string    `json:"icon_url,omitempty"`
+	NameColor       *HexColor `json:"name_color,omitempty"`
+	BackgroundColor *HexColor `json:"background_color,omitempty"`
+	Tradable        bool      `json:"tradable"`
+	Marketable      bool      `json:"marketable"`
+	AutoStack       bool      `json:"auto_stack"`
+	Promo           string    `json:"promo,omitempty"`
+
+	DropInterval  int32 `json:"drop_interval,omitempty"`
+	UseDropWindow *bool `json:"use_drop_window,omitempty"`
+	DropWindow    int32 `json:"drop_window,omitempty"`
+	UseDropLimit  *bool `json:"use_drop_limit,omitempty"`
+	DropLimit     int32 `json:"drop_limit,omitempty"`
+
+	Bundle               BundleDefs       `json:"bundle,omitempty"`
+	Tags                 KeyValuePairs    `json:"tags,omitempty"`
+	AllowedTagsFromTools KeyValuePairs    `json:"allowed_tags_from_tools,omitempty"`
+	AccessoryTag         string           `json:"accessory_tag,omitempty"`
+	Exchange             ExchangeRecipes  `json:"exchange,omitempty"`
+	TagGenerators        IDList           `json:"tag_generators,omitempty"`
+	TagGeneratorName     string           `json:"tag_generator_name,omitempty"`
+	TagGeneratorValues   ValueWeightPairs `json:"tag_generator_values,omitempty"`
+
+	// game-specific fields; these will vary per game
+	TranslatorNote                 string     `json:"translator_note,omitempty"`
+	ItemSlot                       string     `json:"item_slot,omitempty"`
+	CompressedDynamicProps         StringList `json:"compressed_dynamic_props,omitempty"`
+	AfterDescription               string     `json:"after_description,omitempty"`
+	AccessoryDescription           string     `json:"accessory_description,omitempty"`
+	AccessoryDescriptionBrazilian  string     `json:"accessory_description_brazilian,omitempty"`
+	AccessoryDescriptionCzech      string     `json:"accessory_description_czech,omitempty"`
+	AccessoryDescriptionDanish     string     `json:"accessory_description_danish,omitempty"`
+	AccessoryDescriptionDutch      string     `json:"accessory_description_dutch,omitempty"`
+	AccessoryDescriptionEnglish    string     `json:"accessory_description_english,omitempty"`
+	AccessoryDescriptionFinnish    string     `json:"accessory_description_finnish,omitempty"`
+	AccessoryDescriptionFrench     string     `json:"accessory_description_french,omitempty"`
+	AccessoryDescriptionGerman     string     `json:"accessory_description_german,omitempty"`
+	AccessoryDescriptionHungarian  string     `json:"accessory_description_hungarian,omitempty"`
+	AccessoryDescriptionItalian    string     `json:"accessory_description_italian,omitempty"`
+	AccessoryDescriptionJapanese   string     `json:"accessory_description_japanese,omitempty"`
+	AccessoryDescriptionKoreanA    string     `json:"accessory_description_koreana,omitempty"`
+	AccessoryDescriptionNorwegian  string     `json:"accessory_description_norwegian,omitempty"`
+	AccessoryDescriptionPolish     string     `json:"accessory_description_polish,omitempty"`
+	AccessoryDescriptionPortuguese string     `json:"accessory_description_portuguese,omitempty"`
+	AccessoryDescriptionRomanian   string     `json:"accessory_description_romanian,omitempty"`
+	AccessoryDescriptionRussian    string     `json:"accessory_description_russian,omitempty"`
+	AccessoryDescriptionSChinese   string     `json:"accessory_description_schinese,omitempty"`
+	AccessoryDescriptionSpanish    string     `json:"accessory_description_spanish,omitempty"`
+	AccessoryDescriptionSwedish    string     `json:"accessory_description_swedish,omitempty"`
+	AccessoryDescriptionTChinese   string     `json:"accessory_description_tchinese,omitempty"`
+	AccessoryDescriptionThai       string     `json:"accessory_description_thai,omitempty"`
+	AccessoryDescriptionTurkish    string     `json:"accessory_description_turkish,omitempty"`
+	AccessoryDescriptionUkrainian  string     `json:"accessory_description_ukrainian,omitempty"`
+
+	// name of the schema file this item was loaded from
+	File string `json:"-"`
+}
+
+type KeyValuePair struct {
+	Key   string
+	Value string
+}
+
+func (p *KeyValuePair) UnmarshalText(b []byte) error {
+	i := bytes.IndexByte(b, ':')
+	if i == len(b)-1 {
+		return fmt.Errorf("expected string after %q", b)
+	}
+
+	if i == -1 {
+		p.Key, p.Value = string(b), ""
+	} else {
+		p.Key, p.Value = string(b[:i]), string(b[i+1:])
+	}
+
+	return nil
+}
+
+func (p KeyValuePair) MarshalText() ([]byte, error) {
+	if p.Value == "" {
+		return []byte(p.Key), nil
+	}
+
+	return []byte(p.Key + ":" + p.Value), nil
+}
+
+type KeyValuePairs []KeyValuePair
+
+func (p *KeyValuePairs) UnmarshalText(b []byte) error {
+	pairs := bytes.Split(b, []byte{';'})
+
+	*p = make(KeyValuePairs, len(pairs))
+
+	for i, kv := range pairs {
+		err := (*p)[i].UnmarshalText(kv)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p KeyValuePairs) MarshalText() ([]byte, error) {
+	return joinText(len(p), ";", func(i int) ([]byte, error) {
+		return p[i].MarshalText()
+	})
+}
+
+type ValueWeightPair struct {
+	Value  string
+	Weight int32
+}
+
+func (p *ValueWeightPair) UnmarshalText(b []byte) error {
+	i := bytes.IndexByte(b, ':')
+	if i == len(b)-1 {
+		return fmt.Errorf("expected number after %q", b)
+	}
+
+	if i == -1 {
+		p.Weight = 1
+	} else {
+		x, err := strconv.ParseInt(string(b[i+1:]), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		if x <= 0 {
+			return fmt.Errorf("invalid weight: %d", x)
+		}
+
+		p.Weight = int32(x)
+
+		b = b[:i]
+	}
+
+	p.Value = string(b)
+
+	return nil
+}
+
+func (p ValueWeightPair) MarshalText() ([]byte, error) {
+	if p.Weight == 1 {
+		return []byte(p.Value), nil
+	}
+
+	return []byte(p.Value + ":" + strconv.FormatInt(int64(p.Weight), 10)), nil
+}
+
+type ValueWeightPairs []ValueWeightPair
+
+func (p *ValueWeightPairs) UnmarshalText(b []byte) error {
+	pairs := bytes.Split(b, []byte{';'})
+
+	*p = make(ValueWeightPairs, len(pairs))
+
+	for i, vw := range pairs {
+		err := (*p)[i].UnmarshalText(vw)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p ValueWeightPairs) MarshalText() ([]byte, error) {
+	return joinText(len(p), ";", func(i int) ([]byte, error) {
+		return p[i].MarshalText()
+	})
+}
+
+type BundleDef struct {
+	Item     int32
+	Quantity int32
+}
+
+func (d *BundleDef) UnmarshalText(b []byte) error {
+	i := bytes.IndexByte(b, 'x')
+	if i == -1 {
+		d.Quantity = 1
+	} else {
+		x, err := strconv.ParseInt(string(b[i+1:]), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		if x <= 0 {
+			return fmt.Errorf("invalid quantity: %d", x)
+		}
+
+		d.Quantity = int32(x)
+
+		b = b[:i]
+	}
+
+	x, err := strconv.ParseInt(string(b), 10, 32)
+	if err != nil {
+		return err
+	}
+
+	if x <= 0 || x >= 1000000000 {
+		return fmt.Errorf("invalid item id: %d", x)
+	}
+
+	d.Item = int32(x)
+
+	return nil
+}
+
+func (d BundleDef) MarshalText() ([]byte, error) {
+	if d.Quantity == 1 {
+		return []byte(strconv.FormatInt(int64(d.Item), 10)), nil
+	}
+
+	return []byte(strconv.FormatInt(int64(d.Item), 10) + "x" + strconv.FormatInt(int64(d.Quantity), 10)), nil
+}
+
+type BundleDefs []BundleDef
+
+func (d *BundleDefs) UnmarshalText(b []byte) error {
+	defs := bytes.Split(b, []byte{';'})
+
+	*d = make(BundleDefs, len(defs))
+
+	for i, def := range defs {
+		err := (*d)[i].UnmarshalText(def)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d BundleDefs) MarshalText() ([]byte, error) {
+	return joinText(len(d), ";", func(i int) ([]byte, error) {
+		return d[i].MarshalText()
+	})
+}
+
+// ExchangeInput is one material in an exchange recipe: either a quantity of
+// a specific item ("101x2") or a quantity of any items carrying a tag
+// ("strange:5000x2").
+type ExchangeInput struct {
+	Item     int32
+	Tag      KeyValuePair
+	Quantity int32
+}
+
+func (in *ExchangeInput) UnmarshalText(b []byte) error {
+	if colon := bytes.IndexByte(b, ':'); colon != -1 {
+		in.Item = 0
+		in.Quantity = 1
+
+		// the x is only a quantity if a number follows it, so tag values
+		// can still contain an x
+		if i := bytes.LastIndexByte(b, 'x'); i > colon && isDigits(b[i+1:]) {
+			x, err := strconv.ParseInt(string(b[i+1:]), 10, 32)
+			if err != nil {
+				return err
+			}
+
+			if x <= 0 {
+				return fmt.Errorf("invalid quantity: %d", x)
+			}
+
+			in.Quantity = int32(x)
+
+			b = b[:i]
+		}
+
+		if colon == 0 || colon == len(b)-1 {
+			return fmt.Errorf("tag input %q must have a key and a value", b)
+		}
+
+		return in.Tag.UnmarshalText(b)
+	}
+
+	var d BundleDef
+	err := d.UnmarshalText(b)
+	if err != nil {
+		return err
+	}
+
+	in.Item, in.Tag, in.Quantity = d.Item, KeyValuePair{}, d.Quantity
+
+	return nil
+}
+
+func (in ExchangeInput) MarshalText() ([]byte, error) {
+	if in.Item != 0 {
+		return BundleDef{Item: in.Item, Quantity: in.Quantity}.MarshalText()
+	}
+
+	tag, err := in.Tag.MarshalText()
+	if err != nil || in.Quantity == 1 {
+		return tag, err
+	}
+
+	return append(tag, "x"+strconv.FormatInt(int64(in.Quantity), 10)...), nil
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return len(b) != 0
+}
+
+type ExchangeRecipe []ExchangeInput
+
+func (r *ExchangeRecipe) UnmarshalText(b []byte) error {
+	inputs := bytes.Split(b, []byte{','})
+
+	*r = make(ExchangeRecipe, len(inputs))
+
+	for i, input := range inputs {
+		err := (*r)[i].UnmarshalText(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r ExchangeRecipe) MarshalText() ([]byte, error) {
+	return joinText(len(r), ",", func(i int) ([]byte, error) {
+		return r[i].MarshalText()
+	})
+}
+
+type ExchangeRecipes []ExchangeRecipe
+
+func (r *ExchangeRecipes) UnmarshalText(b []byte) error {
+	recipes := bytes.Split(b, []byte{';'})
+
+	*r = make(ExchangeRecipes, len(recipes))
+
+	for i, recipe := range recipes {
+		err := (*r)[i].UnmarshalText(recipe)
+		if err != nil {
+			return fmt.Errorf("invalid exchange recipe %q: %w", recipe, err)
+		}
+	}
+
+	return nil
+}
+
+func (r ExchangeRecipes) MarshalText() ([]byte, error) {
+	return joinText(len(r), ";", func(i int) ([]byte, error) {
+		return r[i].MarshalText()
+	})
+}
+
+type IDList []int32
+
+func (l *IDList) UnmarshalText(b []byte) error {
+	ids := bytes.Split(b, []byte{';'})
+
+	*l = make(IDList, len(ids))
+
+	for i, id := range ids {
+		x, err := strconv.ParseInt(string(id), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		if x <= 0 || x >= 1000000000 {
+			return fmt.Errorf("invalid item id: %d", x)
+		}
+
+		(*l)[i] = int32(x)
+	}
+
+	return nil
+}
+
+func (l IDList) MarshalText() ([]byte, error) {
+	return joinText(len(l), ";", func(i int) ([]byte, error) {
+		return []byte(strconv.FormatInt(int64(l[i]), 10)), nil
+	})
+}
+
+type StringList []string
+
+func (l *StringList) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*l = nil
+
+		return nil
+	}
+
+	*l = strings.Split(string(b), ";")
+
+	return nil
+}
+
+func (l StringList) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(l, ";")), nil
+}
+
+type HexColor struct {
+	R, G, B uint8
+}
+
+func (c *HexColor) UnmarshalText(b []byte) error {
+	n, err := fmt.Sscanf(string(b), "%02x%02x%02x", &c.R, &c.G, &c.B)
+	if err == nil && n != 3 {
+		return fmt.Errorf("invalid hex color: %q", b)
+	}
+
+	return err
+}
+
+func (c HexColor) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%02X%02X%02X", c.R, c.G, c.B)), nil
+}
+
+// joinText joins the text forms of n values with sep.
+func joinText(n int, sep string, marshal func(int) ([]byte, error)) ([]byte, error) {
+	var buf []byte
+
+	for i := 0; i < n; i++ {
+		if i != 0 {
+			buf = append(buf, sep...)
+		}
+
+		b, err := marshal(i)
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, b...)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,172 @@
+package steaminventory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTime is when the items in tests are acquired.
+var testTime = time.Date(2017, time.April, 20, 0, 0, 0, 0, time.UTC)
+
+var (
+	schemaOnce sync.Once
+	schemaDefs map[int32]*ItemDef
+	schemaErr  error
+)
+
+// testItemDefs loads the item schemas at the root of the repository once for all tests.
+// Tests must not modify the definitions.
+func testItemDefs(t testing.TB) map[int32]*ItemDef {
+	t.Helper()
+
+	schemaOnce.Do(func() {
+		schemaDefs, schemaErr = LoadItemDefs("../item-schema-*.json")
+	})
+
+	if schemaErr != nil {
+		t.Fatal(schemaErr)
+	}
+
+	return schemaDefs
+}
+
+// testSchema loads testdata/item-schema-<name>.json, a small schema for the
+// tests of one feature. Each call loads the file again, so tests may modify
+// the definitions.
+func testSchema(t testing.TB, name string) map[int32]*ItemDef {
+	t.Helper()
+
+	defs, err := LoadItemDefs(filepath.Join("testdata", "item-schema-"+name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return defs
+}
+
+func TestExchangeRecipesText(t *testing.T) {
+	tests := []struct {
+		text string
+		want ExchangeRecipes
+		err  bool
+	}{
+		{
+			text: "4001",
+			want: ExchangeRecipes{{{Item: 4001, Quantity: 1}}},
+		},
+		{
+			text: "101x2,102;103x5",
+			want: ExchangeRecipes{
+				{{Item: 101, Quantity: 2}, {Item: 102, Quantity: 1}},
+				{{Item: 103, Quantity: 5}},
+			},
+		},
+		{
+			text: "4000,strange:5000",
+			want: ExchangeRecipes{{{Item: 4000, Quantity: 1}, {Tag: KeyValuePair{"strange", "5000"}, Quantity: 1}}},
+		},
+		{
+			text: "strange:5000x2",
+			want: ExchangeRecipes{{{Tag: KeyValuePair{"strange", "5000"}, Quantity: 2}}},
+		},
+		{
+			text: "style:box",
+			want: ExchangeRecipes{{{Tag: KeyValuePair{"style", "box"}, Quantity: 1}}},
+		},
+		{
+			text: "style:boxx3",
+			want: ExchangeRecipes{{{Tag: KeyValuePair{"style", "box"}, Quantity: 3}}},
+		},
+		{text: ":5000", err: true},
+		{text: "strange:", err: true},
+		{text: "strange:x2", err: true},
+		{text: "strange:5000x0", err: true},
+		{text: "101x0", err: true},
+		{text: "101,", err: true},
+		{text: "abc", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var got ExchangeRecipes
+			err := got.UnmarshalText([]byte(tt.text))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			text, err := got.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var again ExchangeRecipes
+			if err = again.UnmarshalText(text); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("%q does not round trip: got %v (%v)", text, again, err)
+			}
+		})
+	}
+}
+
+func TestLoadItemDefsPattern(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "item-schema-test.json"), []byte(`{
+	"appid": 563560,
+	"items": [
+		{"itemdefid": 1, "type": "item", "name": "Hat"}
+	]
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pattern := range []string{dir, filepath.Join(dir, "*.json")} {
+		defs, err := LoadItemDefs(pattern)
+		if err != nil {
+			t.Errorf("%s: %v", pattern, err)
+		} else if len(defs) != 1 || defs[1] == nil {
+			t.Errorf("%s: got %v, want item 1", pattern, defs)
+		}
+	}
+
+	_, err = LoadItemDefs(filepath.Join(dir, "missing-*.json"))
+	if err == nil || !strings.Contains(err.Error(), "no item schemas match") {
+		t.Errorf("got error %v, want an error about the missing schemas", err)
+	}
+}
+
+func TestLoadItemDefsRejectsEmptyTagInput(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "item-schema-test.json"), []byte(`{
+	"appid": 563560,
+	"items": [
+		{"itemdefid": 1, "type": "item", "name": "Tool", "exchange": ":5000"}
+	]
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadItemDefs(dir)
+	if err == nil || !strings.Contains(err.Error(), "must have a key and a value") {
+		t.Errorf("got error %v, want an error about the empty tag key", err)
+	}
+}
@@ -0,0 +1,136 @@
+package steaminventory
+
+import (
+	"fmt"
+	"time"
+)
+
+// DropState tracks one player's progress towards drops from one
+// playtimegenerator, like Steam does for TriggerItemDrop.
+type DropState struct {
+	// total playtime of the player when the current drop interval started
+	IntervalStart time.Duration `json:"interval_start"`
+	LastDrop      time.Time     `json:"last_drop"`
+	Drops         int32         `json:"drops"`
+}
+
+// SimulatedPlayer is a player with an inventory and drop timers.
+type SimulatedPlayer struct {
+	Inventory *Inventory
+	Playtime  time.Duration
+	Drops     map[int32]*DropState
+
+	// marine classes the player has unlocked
+	Classes []string
+
+	// promo items the player has already received
+	ClaimedPromos map[int32]bool
+
+	// days of a scenario that have been simulated for the player
+	Days int32
+}
+
+func NewSimulatedPlayer(ids *ItemIDAllocator) *SimulatedPlayer {
+	return &SimulatedPlayer{
+		Inventory: NewInventory(ids),
+		Drops:     make(map[int32]*DropState),
+	}
+}
+
+// Play records playtime towards every playtimegenerator.
+func (p *SimulatedPlayer) Play(playtime time.Duration) {
+	p.Playtime += playtime
+}
+
+func (p *SimulatedPlayer) dropState(id int32) *DropState {
+	state, ok := p.Drops[id]
+	if !ok {
+		state = &DropState{}
+		p.Drops[id] = state
+	}
+
+	return state
+}
+
+// TriggerItemDrop checks whether the playtimegenerator id is allowed to drop
+// an item for the player at time now. If it is, the drop is recorded and the
+// generated items are granted to the player's inventory. Nothing drops from
+// items that aren't playtimegenerators, but an unknown id is an error.
+func (p *SimulatedPlayer) TriggerItemDrop(defs map[int32]*ItemDef, r Roller, id int32, now time.Time) ([]*ItemInstance, error) {
+	def, ok := defs[id]
+	if !ok {
+		return nil, fmt.Errorf("cannot drop unknown item %d", id)
+	}
+
+	if def.Type != "playtimegenerator" {
+		return nil, nil
+	}
+
+	state := p.dropState(id)
+	if !canDrop(def, state, p.Playtime, now) {
+		return nil, nil
+	}
+
+	items, err := GenerateItems(defs, TaggedBundleDefs{
+		{
+			Item:     id,
+			Quantity: 1,
+		},
+	}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	recordDrop(def, state, p.Playtime, now)
+
+	return p.Inventory.Grant(defs, items, now, OriginPlaytime), nil
+}
+
+// canDrop implements the drop_interval, drop_window, and drop_limit rules.
+func canDrop(def *ItemDef, state *DropState, playtime time.Duration, now time.Time) bool {
+	if playtime-state.IntervalStart < time.Duration(def.DropInterval)*time.Minute {
+		return false
+	}
+
+	if useDropWindow(def) && state.Drops != 0 && now.Sub(state.LastDrop) < time.Duration(def.DropWindow)*time.Minute {
+		return false
+	}
+
+	if useDropLimit(def) && state.Drops >= def.DropLimit {
+		return false
+	}
+
+	return true
+}
+
+func recordDrop(def *ItemDef, state *DropState, playtime time.Duration, now time.Time) {
+	// leftover playtime counts towards the next drop, but playtime can't be
+	// banked for more than one drop.
+	leftover := time.Duration(0)
+	if def.DropInterval > 0 {
+		leftover = (playtime - state.IntervalStart) % (time.Duration(def.DropInterval) * time.Minute)
+	}
+
+	state.IntervalStart = playtime - leftover
+
+	state.LastDrop = now
+	state.Drops++
+}
+
+// the use_ flags are optional; if they're missing, the rule is in effect
+// whenever it has a value.
+func useDropWindow(def *ItemDef) bool {
+	if def.UseDropWindow != nil {
+		return *def.UseDropWindow
+	}
+
+	return def.DropWindow != 0
+}
+
+func useDropLimit(def *ItemDef) bool {
+	if def.UseDropLimit != nil {
+		return *def.UseDropLimit
+	}
+
+	return def.DropLimit != 0
+}
@@ -0,0 +1,142 @@
+package steaminventory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanDrop(t *testing.T) {
+	no := false
+
+	type step struct {
+		// playtime and wall clock time that pass before the drop is triggered
+		Play, wait time.Duration
+		drop       bool
+	}
+
+	tests := []struct {
+		name  string
+		def   ItemDef
+		steps []step
+	}{
+		{
+			name: "interval",
+			def:  ItemDef{DropInterval: 30},
+			steps: []step{
+				{Play: 20 * time.Minute, drop: false},
+				{Play: 10 * time.Minute, drop: true},
+				{Play: 29 * time.Minute, drop: false},
+				{Play: 1 * time.Minute, drop: true},
+			},
+		},
+		{
+			name: "interval leftover",
+			def:  ItemDef{DropInterval: 30},
+			steps: []step{
+				{Play: 45 * time.Minute, drop: true},
+				{Play: 15 * time.Minute, drop: true},
+				// playtime is not banked for more than one drop
+				{Play: 90 * time.Minute, drop: true},
+				{Play: 0, drop: false},
+				{Play: 30 * time.Minute, drop: true},
+			},
+		},
+		{
+			name: "window rollover",
+			def:  ItemDef{DropWindow: 60},
+			steps: []step{
+				{wait: 0, drop: true},
+				{wait: 30 * time.Minute, drop: false},
+				{wait: 30 * time.Minute, drop: true},
+				{wait: 59 * time.Minute, drop: false},
+				{wait: 1 * time.Minute, drop: true},
+			},
+		},
+		{
+			name: "window disabled",
+			def:  ItemDef{DropWindow: 60, UseDropWindow: &no},
+			steps: []step{
+				{drop: true},
+				{drop: true},
+			},
+		},
+		{
+			name: "limit exhausted",
+			def:  ItemDef{DropLimit: 2},
+			steps: []step{
+				{drop: true},
+				{wait: 24 * time.Hour, drop: true},
+				{wait: 24 * time.Hour, drop: false},
+				{Play: time.Hour, wait: 365 * 24 * time.Hour, drop: false},
+			},
+		},
+		{
+			name: "limit disabled",
+			def:  ItemDef{DropLimit: 1, UseDropLimit: &no},
+			steps: []step{
+				{drop: true},
+				{drop: true},
+				{drop: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				state    DropState
+				playtime time.Duration
+			)
+			now := testTime
+
+			for i, s := range tt.steps {
+				playtime += s.Play
+				now = now.Add(s.wait)
+
+				drop := canDrop(&tt.def, &state, playtime, now)
+				if drop != s.drop {
+					t.Fatalf("step %d: canDrop = %v, want %v", i, drop, s.drop)
+				}
+
+				if drop {
+					recordDrop(&tt.def, &state, playtime, now)
+				}
+			}
+		})
+	}
+}
+
+func TestTriggerItemDrop(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item"},
+		2: {ID: 2, Type: "playtimegenerator", Bundle: BundleDefs{{Item: 1, Quantity: 1}}, DropInterval: 60, DropLimit: 1},
+	}
+
+	player := NewSimulatedPlayer(&ItemIDAllocator{})
+	now := testTime
+
+	for i, want := range []int{0, 1, 0} {
+		player.Play(30 * time.Minute)
+
+		granted, err := player.TriggerItemDrop(defs, NewRoller(0), 2, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(granted) != want {
+			t.Errorf("trigger %d granted %d items, want %d", i, len(granted), want)
+		}
+	}
+
+	if len(player.Inventory.Items) != 1 || player.Inventory.Items[0].Item != 1 {
+		t.Errorf("inventory holds %+v", player.Inventory.Items)
+	}
+
+	if granted, err := player.TriggerItemDrop(defs, NewRoller(0), 1, now); err != nil || granted != nil {
+		t.Errorf("trigger for an item that isn't a playtimegenerator: got %v, %v", granted, err)
+	}
+
+	if granted, err := player.TriggerItemDrop(defs, NewRoller(0), 99999, now); err == nil {
+		t.Errorf("trigger for an unknown item: got %v, want an error", granted)
+	}
+}
@@ -0,0 +1,178 @@
+package steaminventory
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// reasons a device can't be extracted
+var (
+	errNotDevice          = errors.New("device is not a tag_tool")
+	errHostIsDevice       = errors.New("host is a tag_tool")
+	errDeviceNotAttached  = errors.New("device is not attached to host")
+	errNoExtractionRecipe = errors.New("no exchange recipe of the device takes the tool and the host")
+)
+
+type ExtractionError struct {
+	ToolID uint64
+	HostID uint64
+	Device int32
+	Err    error
+}
+
+func (e *ExtractionError) Error() string {
+	return fmt.Sprintf("cannot extract device %d from item %d using item %d: %v", e.Device, e.HostID, e.ToolID, e.Err)
+}
+
+func (e *ExtractionError) Unwrap() error {
+	return e.Err
+}
+
+// extractDevice removes the tag tool device from the host item using the
+// item tool, following the exchange recipe of the device that takes the
+// tool and the device's tag (for example "4000,strange:5000"). The tool and
+// the host are destroyed, along with every other device attached to the
+// host, and a new instance of the device is created with its counter
+// cleared. What happened is appended to the inventory's event log and
+// returned.
+func (inv *Inventory) extractDevice(defs map[int32]*ItemDef, toolItemID, hostItemID uint64, device int32, now time.Time) ([]InventoryEvent, error) {
+	tool := inv.Find(toolItemID)
+	if tool == nil {
+		return nil, &ItemNotFoundError{ItemID: toolItemID}
+	}
+
+	host := inv.Find(hostItemID)
+	if host == nil {
+		return nil, &ItemNotFoundError{ItemID: hostItemID}
+	}
+
+	fail := func(err error) error {
+		return &ExtractionError{
+			ToolID: toolItemID,
+			HostID: hostItemID,
+			Device: device,
+			Err:    err,
+		}
+	}
+
+	deviceDef, ok := defs[device]
+	if !ok || deviceDef.Type != "tag_tool" {
+		return nil, fail(errNotDevice)
+	}
+
+	hostDef := defs[host.Item]
+	if hostDef.Type == "tag_tool" {
+		return nil, fail(errHostIsDevice)
+	}
+
+	attached := attachedTools(defs, hostDef, host.Tags)
+
+	found := false
+	for _, d := range attached {
+		if d.ID == device {
+			found = true
+
+			break
+		}
+	}
+	if !found {
+		return nil, fail(errDeviceNotAttached)
+	}
+
+	if !hasExtractionRecipe(deviceDef, tool, hostDef.AccessoryTag) {
+		return nil, fail(errNoExtractionRecipe)
+	}
+
+	var events []InventoryEvent
+	event := func(action string, item *ItemInstance, quantity int32) {
+		events = append(events, InventoryEvent{
+			Time:     now,
+			Action:   action,
+			ItemID:   item.ItemID,
+			Item:     item.Item,
+			Quantity: quantity,
+			Tags:     append(KeyValuePairs(nil), item.Tags...),
+			Props:    copyProps(item.DynamicProps),
+		})
+	}
+
+	event(EventConsumed, tool, 1)
+	if err := inv.Consume(toolItemID, 1); err != nil {
+		return nil, err
+	}
+
+	event(EventDestroyed, host, host.Quantity)
+	if err := inv.Consume(hostItemID, host.Quantity); err != nil {
+		return nil, err
+	}
+
+	for _, d := range attached {
+		if d.ID != device {
+			events = append(events, InventoryEvent{
+				Time:     now,
+				Action:   EventDeviceDestroyed,
+				ItemID:   hostItemID,
+				Item:     d.ID,
+				Quantity: 1,
+			})
+		}
+	}
+
+	for _, item := range inv.Grant(defs, TaggedBundleDefs{{Item: device, Quantity: 1}}, now, OriginExchange) {
+		event(EventCreated, item, 1)
+	}
+
+	inv.Events = append(inv.Events, events...)
+
+	return events, nil
+}
+
+// hasExtractionRecipe returns true if one of the device's exchange recipes
+// takes exactly one of the tool and the device's own tag on an item with
+// the given accessory tag.
+func hasExtractionRecipe(deviceDef *ItemDef, tool *ItemInstance, accessoryTag string) bool {
+	deviceTag := KeyValuePair{
+		Key:   accessoryTag,
+		Value: strconv.Itoa(int(deviceDef.ID)),
+	}
+
+	for _, recipe := range deviceDef.Exchange {
+		if len(recipe) != 2 {
+			continue
+		}
+
+		usesTool, usesHost := false, false
+		for _, input := range recipe {
+			if input.Quantity != 1 {
+				continue
+			}
+
+			if input.Item != 0 && input.Item == tool.Item {
+				usesTool = true
+			} else if input.Item == 0 && input.Tag == deviceTag {
+				usesHost = true
+			}
+		}
+
+		if usesTool && usesHost {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyProps(props map[string]int64) map[string]int64 {
+	if props == nil {
+		return nil
+	}
+
+	c := make(map[string]int64, len(props))
+	for k, v := range props {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,212 @@
+package steaminventory
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestExtractDevice(t *testing.T) {
+	tests := []struct {
+		name      string
+		tool      int32
+		host      int32
+		hostTags  KeyValuePairs
+		device    int32
+		err       error
+		destroyed []int32
+	}{
+		{name: "extract", tool: 50, host: 1, hostTags: KeyValuePairs{{"strange", "10"}}, device: 10},
+		{name: "other devices are destroyed", tool: 50, host: 1, hostTags: KeyValuePairs{{"strange", "10"}, {"strange", "11"}, {"strange", "12"}}, device: 11, destroyed: []int32{10, 12}},
+		{name: "device not attached", tool: 50, host: 1, hostTags: KeyValuePairs{{"strange", "10"}}, device: 11, err: errDeviceNotAttached},
+		{name: "not a device", tool: 50, host: 1, hostTags: KeyValuePairs{{"strange", "10"}}, device: 30, err: errNotDevice},
+		{name: "host is a device", tool: 50, host: 11, device: 10, err: errHostIsDevice},
+		{name: "wrong tool", tool: 30, host: 1, hostTags: KeyValuePairs{{"strange", "10"}}, device: 10, err: errNoExtractionRecipe},
+	}
+
+	defs := testSchema(t, "tagtools")
+	now := testTime
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory(&ItemIDAllocator{})
+			granted := inv.Grant(defs, TaggedBundleDefs{{Item: tt.tool, Quantity: 1}, {Item: tt.host, Quantity: 1, Tags: tt.hostTags}}, now, OriginExternal)
+			tool, host := granted[0], granted[1]
+			if host.DynamicProps != nil {
+				host.DynamicProps["strange_"+strconv.Itoa(int(tt.device))] = 100
+			}
+
+			events, err := inv.extractDevice(defs, tool.ItemID, host.ItemID, tt.device, now)
+
+			if tt.err != nil {
+				var extraction *ExtractionError
+				if !errors.Is(err, tt.err) || !errors.As(err, &extraction) {
+					t.Fatalf("got error %v, want an ExtractionError for %v", err, tt.err)
+				}
+
+				if len(inv.Items) != 2 || len(inv.Events) != 0 {
+					t.Errorf("a refused extraction changed the inventory: %d items, %d events", len(inv.Items), len(inv.Events))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(inv.Items) != 1 || inv.Items[0].Item != tt.device {
+				t.Fatalf("inventory holds %+v, want only the device", inv.Items)
+			}
+
+			if counter := inv.Items[0].DynamicProps["strange_"+strconv.Itoa(int(tt.device))]; counter != 0 {
+				t.Errorf("extracted device has counter %d, want 0", counter)
+			}
+
+			var actions []string
+			var destroyed []int32
+			for _, e := range events {
+				actions = append(actions, e.Action)
+				if e.Action == EventDeviceDestroyed {
+					destroyed = append(destroyed, e.Item)
+				}
+
+				// the host's counters are logged as they were before it was destroyed
+				if e.Action == EventDestroyed && e.Props["strange_"+strconv.Itoa(int(tt.device))] != 100 {
+					t.Errorf("destroyed host was logged with counters %v", e.Props)
+				}
+			}
+
+			if len(actions) != 3+len(tt.destroyed) || actions[0] != EventConsumed || actions[1] != EventDestroyed || actions[len(actions)-1] != EventCreated {
+				t.Errorf("got events %v", actions)
+			}
+
+			if !reflect.DeepEqual(destroyed, tt.destroyed) {
+				t.Errorf("got destroyed devices %v, want %v", destroyed, tt.destroyed)
+			}
+
+			if len(inv.Events) != len(events) {
+				t.Errorf("logged %d events, returned %d", len(inv.Events), len(events))
+			}
+		})
+	}
+}
+
+func TestExchangeExtractsDevices(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    int32
+		hostTags  KeyValuePairs
+		reverse   bool
+		quantity  int32
+		err       error
+		created   int32
+		destroyed []int32
+	}{
+		{name: "extract", target: 10, hostTags: KeyValuePairs{{"strange", "10"}}, quantity: 1, created: 10},
+		{name: "host first", target: 10, hostTags: KeyValuePairs{{"strange", "10"}}, reverse: true, quantity: 1, created: 10},
+		{name: "other devices are destroyed", target: 11, hostTags: KeyValuePairs{{"strange", "10"}, {"strange", "11"}, {"strange", "12"}}, quantity: 1, created: 11, destroyed: []int32{10, 12}},
+		{name: "device not attached", target: 11, hostTags: KeyValuePairs{{"strange", "10"}}, quantity: 1, err: errDeviceNotAttached},
+		{name: "two tools", target: 10, hostTags: KeyValuePairs{{"strange", "10"}}, quantity: 2, err: &InsufficientQuantityError{}},
+	}
+
+	defs := testSchema(t, "tagtools")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory(&ItemIDAllocator{})
+			granted := inv.Grant(defs, TaggedBundleDefs{{Item: 50, Quantity: 1}, {Item: 1, Quantity: 1, Tags: tt.hostTags}}, testTime, OriginExternal)
+			tool, host := granted[0], granted[1]
+			host.DynamicProps["strange_"+strconv.Itoa(int(tt.target))] = 100
+
+			materials := []ExchangeMaterial{{ItemID: tool.ItemID, Quantity: tt.quantity}, {ItemID: host.ItemID, Quantity: 1}}
+			if tt.reverse {
+				materials[0], materials[1] = materials[1], materials[0]
+			}
+
+			changed, err := (&SimulatedPlayer{Inventory: inv}).Exchange(defs, materials, tt.target, NewRoller(1), testTime)
+
+			if tt.err != nil {
+				var insufficient *InsufficientQuantityError
+				if _, ok := tt.err.(*InsufficientQuantityError); ok {
+					if !errors.As(err, &insufficient) {
+						t.Fatalf("got error %v, want %v", err, tt.err)
+					}
+				} else if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+
+				if len(inv.Items) != 2 {
+					t.Errorf("a refused exchange changed the inventory: %d items", len(inv.Items))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(changed) != 3 || changed[0].Item != tt.created || changed[1] != tool || changed[2] != host {
+				t.Fatalf("got %v, want the device, the tool, and the host", changed)
+			}
+
+			if counter := changed[0].DynamicProps; len(counter) != 0 {
+				t.Errorf("extracted device has properties %v", counter)
+			}
+
+			if len(inv.Items) != 1 || inv.Items[0] != changed[0] {
+				t.Errorf("inventory has %d items after the extraction, want only the device", len(inv.Items))
+			}
+
+			var destroyed []int32
+			for _, event := range inv.Events {
+				if event.Action == EventDeviceDestroyed {
+					destroyed = append(destroyed, event.Item)
+				}
+			}
+
+			if len(destroyed) != len(tt.destroyed) {
+				t.Errorf("got destroyed devices %v, want %v", destroyed, tt.destroyed)
+			}
+		})
+	}
+}
+
+func TestExchangeFallsBackToRecipes(t *testing.T) {
+	defs := testSchema(t, "tagtools")
+	inv := NewInventory(&ItemIDAllocator{})
+	material := inv.Grant(defs, TaggedBundleDefs{{Item: 30, Quantity: 1}}, testTime, OriginExternal)[0]
+
+	changed, err := (&SimulatedPlayer{Inventory: inv}).Exchange(defs, []ExchangeMaterial{{ItemID: material.ItemID, Quantity: 1}}, 60, NewRoller(1), testTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed) != 2 || changed[0].Item != 60 || changed[1] != material {
+		t.Errorf("got %v, want item 60 and the material", changed)
+	}
+}
+
+func TestClientExchangeItemsExtractsDevices(t *testing.T) {
+	defs := testSchema(t, "tagtools")
+	c := newTestClient(defs)
+	granted := c.player.Inventory.Grant(defs, TaggedBundleDefs{{Item: 50, Quantity: 1}, {Item: 1, Quantity: 1, Tags: KeyValuePairs{{"strange", "10"}}}}, testTime, OriginExternal)
+
+	handle, ok := c.ExchangeItems([]int32{10}, []uint32{1}, []uint64{granted[1].ItemID, granted[0].ItemID}, []uint32{1, 1})
+	if !ok {
+		t.Fatal("ExchangeItems returned an invalid handle")
+	}
+
+	c.RunCallbacks()
+
+	if status := c.GetResultStatus(handle); status != EResultOK {
+		t.Fatalf("got status %d", status)
+	}
+
+	items, _ := c.GetResultItems(handle)
+	if len(items) != 3 || items[0].Definition != 10 || items[1].Flags&ItemFlagRemoved == 0 || items[2].Flags&ItemFlagRemoved == 0 {
+		t.Errorf("got %+v, want the device followed by the removed tool and host", items)
+	}
+}
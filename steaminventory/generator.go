@@ -0,0 +1,316 @@
+package steaminventory
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TaggedBundleDef is a quantity of an item with instance tags. Quantities
+// are counted in int64 so that large simulations can't overflow them.
+type TaggedBundleDef struct {
+	Item     int32
+	Quantity int64
+	Tags     KeyValuePairs
+}
+
+type TaggedBundleDefs []TaggedBundleDef
+
+// GenerateItems expands generators and bundles until only items and tag
+// tools are left. It fails if that takes more than MaxExpansionDepth passes.
+func GenerateItems(defs map[int32]*ItemDef, items TaggedBundleDefs, r Roller) (TaggedBundleDefs, error) {
+	return expandItems(defs, items, r, false)
+}
+
+// GenerateItemsBatch works like GenerateItems, but draws the outcomes of
+// all units of a generator at once. The result has the same distribution,
+// but it takes time proportional to the number of distinct outcomes rather
+// than the number of units.
+func GenerateItemsBatch(defs map[int32]*ItemDef, items TaggedBundleDefs, r Roller) (TaggedBundleDefs, error) {
+	return expandItems(defs, items, r, true)
+}
+
+func expandItems(defs map[int32]*ItemDef, items TaggedBundleDefs, r Roller, batch bool) (TaggedBundleDefs, error) {
+	items1 := append(TaggedBundleDefs(nil), items...)
+
+	any := true
+	for depth := 0; any; depth++ {
+		if depth > MaxExpansionDepth {
+			return nil, expansionDepthError(defs, items1)
+		}
+
+		any = false
+
+		var items2 ItemAggregator
+		for _, item := range items1 {
+			def, ok := defs[item.Item]
+			if !ok {
+				return nil, fmt.Errorf("cannot expand unknown item %d", item.Item)
+			}
+
+			switch def.Type {
+			case "item", "tag_tool":
+				items2.add(item.Item, item.Quantity, item.Tags)
+			case "playtimegenerator", "generator":
+				any = true
+
+				if batch {
+					rollGeneratorBatch(defs, item, r, &items2)
+				} else {
+					rollGenerator(defs, item, r, &items2)
+				}
+			case "bundle":
+				any = true
+
+				for _, b := range def.Bundle {
+					items2.add(b.Item, int64(b.Quantity)*item.Quantity, append(KeyValuePairs(nil), item.Tags...))
+				}
+			default:
+				return nil, CheckExpandable(def)
+			}
+		}
+
+		items1 = items2.Items
+	}
+
+	return items1, nil
+}
+
+// CheckExpandable returns an error if def can't be the root of
+// GenerateItems or DropProbabilities. tag_generator items only make sense
+// as part of a generator.
+func CheckExpandable(def *ItemDef) error {
+	switch def.Type {
+	case "item", "tag_tool", "bundle", "generator", "playtimegenerator":
+		return nil
+	case "tag_generator":
+		return fmt.Errorf("item %d is a tag_generator; it can only be rolled by the generators that use it", def.ID)
+	default:
+		return fmt.Errorf("item %d has type %q, which cannot be expanded", def.ID, def.Type)
+	}
+}
+
+// expansionDepthError reports the first item in items that would have
+// needed another expansion pass.
+func expansionDepthError(defs map[int32]*ItemDef, items TaggedBundleDefs) error {
+	for _, item := range items {
+		if t := defs[item.Item].Type; t != "item" && t != "tag_tool" {
+			return fmt.Errorf("item expansion did not finish after %d passes: item %d (%s) is still expanding", MaxExpansionDepth, item.Item, t)
+		}
+	}
+
+	return fmt.Errorf("item expansion did not finish after %d passes", MaxExpansionDepth)
+}
+
+// rollGenerator rolls the tags and bundle option of each unit of a
+// generator separately.
+func rollGenerator(defs map[int32]*ItemDef, item TaggedBundleDef, r Roller, out *ItemAggregator) {
+	def := defs[item.Item]
+
+	totalWeight := int64(0)
+	for _, option := range def.Bundle {
+		totalWeight += int64(option.Quantity)
+	}
+
+	for i := int64(0); i < item.Quantity; i++ {
+		tags := append(KeyValuePairs(nil), item.Tags...)
+
+		for _, tgid := range def.TagGenerators {
+			tgdef := defs[tgid]
+			totalTagWeight := int64(0)
+
+			for _, option := range tgdef.TagGeneratorValues {
+				totalTagWeight += int64(option.Weight)
+			}
+
+			tagWeight := r.Roll(tgid, totalTagWeight)
+
+			for _, option := range tgdef.TagGeneratorValues {
+				tagWeight -= int64(option.Weight)
+				if tagWeight < 0 {
+					tags = append(tags, KeyValuePair{
+						Key:   tgdef.TagGeneratorName,
+						Value: option.Value,
+					})
+					break
+				}
+			}
+		}
+
+		weight := r.Roll(item.Item, totalWeight)
+		for _, option := range def.Bundle {
+			weight -= int64(option.Quantity)
+			if weight < 0 {
+				out.add(option.Item, 1, tags)
+				break
+			}
+		}
+	}
+}
+
+// rollGeneratorBatch splits the units of a generator between every
+// combination of generated tags, and then splits each group between the
+// bundle options, using one multinomial sample per split.
+func rollGeneratorBatch(defs map[int32]*ItemDef, item TaggedBundleDef, r Roller, out *ItemAggregator) {
+	def := defs[item.Item]
+
+	groups := TaggedBundleDefs{item}
+	for _, tgid := range def.TagGenerators {
+		tgdef := defs[tgid]
+
+		weights := make([]int64, len(tgdef.TagGeneratorValues))
+		for i, option := range tgdef.TagGeneratorValues {
+			weights[i] = int64(option.Weight)
+		}
+
+		var split TaggedBundleDefs
+		for _, group := range groups {
+			counts := multinomial(r, tgid, group.Quantity, weights)
+			for i, count := range counts {
+				if count == 0 {
+					continue
+				}
+
+				split = append(split, TaggedBundleDef{
+					Item:     group.Item,
+					Quantity: count,
+					Tags: append(append(KeyValuePairs(nil), group.Tags...), KeyValuePair{
+						Key:   tgdef.TagGeneratorName,
+						Value: tgdef.TagGeneratorValues[i].Value,
+					}),
+				})
+			}
+		}
+
+		groups = split
+	}
+
+	weights := make([]int64, len(def.Bundle))
+	for i, option := range def.Bundle {
+		weights[i] = int64(option.Quantity)
+	}
+
+	for _, group := range groups {
+		counts := multinomial(r, item.Item, group.Quantity, weights)
+		for i, count := range counts {
+			if count != 0 {
+				out.add(def.Bundle[i].Item, count, group.Tags)
+			}
+		}
+	}
+}
+
+type itemKey struct {
+	item int32
+	tags string
+}
+
+// ItemAggregator adds up quantities of items with the same itemdefid and
+// tags. Items are kept in the order they were first added. The zero value
+// is ready to use.
+type ItemAggregator struct {
+	index map[itemKey]int
+	Items TaggedBundleDefs
+}
+
+func (a *ItemAggregator) add(id int32, quantity int64, tags KeyValuePairs) {
+	key := itemKey{
+		item: id,
+		tags: TagsKey(tags),
+	}
+
+	if i, ok := a.index[key]; ok {
+		a.Items[i].Quantity += quantity
+
+		return
+	}
+
+	if a.index == nil {
+		a.index = make(map[itemKey]int)
+	}
+
+	a.index[key] = len(a.Items)
+	a.Items = append(a.Items, TaggedBundleDef{
+		Item:     id,
+		Quantity: quantity,
+		Tags:     tags,
+	})
+}
+
+func (a *ItemAggregator) AddAll(items TaggedBundleDefs) {
+	for _, item := range items {
+		a.add(item.Item, item.Quantity, item.Tags)
+	}
+}
+
+// tagKeys interns the keys returned by TagsKey, so that every tag set is
+// stored once no matter how many stacks use it, and looking up a tag set
+// that was seen before doesn't allocate.
+var tagKeys = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// TagsKey returns a canonical form of a tag list. Two tag lists have the
+// same key if they contain the same tags, in any order.
+func TagsKey(tags KeyValuePairs) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	var buf [128]byte
+
+	return internTagsKey(appendTagsKey(buf[:0], tags))
+}
+
+// appendTagsKey appends the tags to buf sorted by key and then value, as
+// key:value pairs separated by semicolons.
+func appendTagsKey(buf []byte, tags KeyValuePairs) []byte {
+	// tag lists are short, so sort a copy on the stack
+	var small [8]KeyValuePair
+	sorted := append(small[:0], tags...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && lessKeyValuePair(sorted[j], sorted[j-1]); j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+
+	for i, kv := range sorted {
+		if i != 0 {
+			buf = append(buf, ';')
+		}
+
+		buf = append(buf, kv.Key...)
+		buf = append(buf, ':')
+		buf = append(buf, kv.Value...)
+	}
+
+	return buf
+}
+
+func lessKeyValuePair(a, b KeyValuePair) bool {
+	if a.Key == b.Key {
+		return a.Value < b.Value
+	}
+
+	return a.Key < b.Key
+}
+
+func internTagsKey(b []byte) string {
+	tagKeys.RLock()
+	key, ok := tagKeys.m[string(b)]
+	tagKeys.RUnlock()
+
+	if ok {
+		return key
+	}
+
+	tagKeys.Lock()
+	defer tagKeys.Unlock()
+
+	if key, ok = tagKeys.m[string(b)]; !ok {
+		key = string(b)
+		tagKeys.m[key] = key
+	}
+
+	return key
+}
@@ -0,0 +1,234 @@
+package steaminventory
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateItems(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item"},
+		2: {ID: 2, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 3}}},
+		3: {ID: 3, Type: "bundle", Bundle: BundleDefs{{Item: 2, Quantity: 2}}},
+		4: {ID: 4, Type: "bundle", Bundle: BundleDefs{{Item: 5, Quantity: 1}}},
+		5: {ID: 5, Type: "bundle", Bundle: BundleDefs{{Item: 4, Quantity: 1}}},
+		6: {ID: 6, Type: "generator", Bundle: BundleDefs{{Item: 4, Quantity: 1}}},
+	}
+
+	tests := []struct {
+		name  string
+		items TaggedBundleDefs
+		want  TaggedBundleDefs
+		err   string
+	}{
+		{
+			name:  "item",
+			items: TaggedBundleDefs{{Item: 1, Quantity: 2}},
+			want:  TaggedBundleDefs{{Item: 1, Quantity: 2}},
+		},
+		{
+			name:  "nested bundles",
+			items: TaggedBundleDefs{{Item: 3, Quantity: 2}},
+			want:  TaggedBundleDefs{{Item: 1, Quantity: 12}},
+		},
+		{
+			name:  "bundle cycle",
+			items: TaggedBundleDefs{{Item: 1, Quantity: 1}, {Item: 4, Quantity: 1}},
+			err:   "item 5 (bundle) is still expanding",
+		},
+		{
+			name:  "generator into cycle",
+			items: TaggedBundleDefs{{Item: 6, Quantity: 1}},
+			err:   "is still expanding",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, generate := range []func(map[int32]*ItemDef, TaggedBundleDefs, Roller) (TaggedBundleDefs, error){GenerateItems, GenerateItemsBatch} {
+				got, err := generate(defs, tt.items, NewRoller(1))
+				if tt.err != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.err) {
+						t.Fatalf("got error %v, want error containing %q", err, tt.err)
+					}
+
+					continue
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestItemAggregator(t *testing.T) {
+	var a ItemAggregator
+	a.add(2, 1, KeyValuePairs{{"a", "1"}, {"b", "2"}})
+	a.add(1, 3, nil)
+	a.add(2, 1, KeyValuePairs{{"b", "2"}, {"a", "1"}})
+	a.add(2, 1, KeyValuePairs{{"a", "1"}})
+	a.AddAll(TaggedBundleDefs{{Item: 1, Quantity: 4}})
+
+	// items stay in the order they were first added
+	want := TaggedBundleDefs{
+		{Item: 2, Quantity: 2, Tags: KeyValuePairs{{"a", "1"}, {"b", "2"}}},
+		{Item: 1, Quantity: 7},
+		{Item: 2, Quantity: 1, Tags: KeyValuePairs{{"a", "1"}}},
+	}
+
+	if !reflect.DeepEqual(a.Items, want) {
+		t.Errorf("got %v, want %v", a.Items, want)
+	}
+}
+
+func TestGenerateItemsRejectsTagGenerator(t *testing.T) {
+	defs := testItemDefs(t)
+
+	for _, batch := range []bool{false, true} {
+		_, err := expandItems(defs, TaggedBundleDefs{{Item: 6001, Quantity: 1}}, NewRoller(1), batch)
+		if err == nil || !strings.Contains(err.Error(), "tag_generator") {
+			t.Errorf("batch=%v: got error %v, want an error about the tag_generator", batch, err)
+		}
+	}
+}
+
+func TestItemAggregatorLargeQuantities(t *testing.T) {
+	var a ItemAggregator
+	a.add(1, math.MaxInt32, nil)
+	a.add(1, math.MaxInt32, nil)
+	a.add(2, 1, KeyValuePairs{{"a", "1"}, {"b", "2"}})
+	a.add(2, 1, KeyValuePairs{{"b", "2"}, {"a", "1"}})
+
+	want := TaggedBundleDefs{
+		{Item: 1, Quantity: 2 * math.MaxInt32},
+		{Item: 2, Quantity: 2, Tags: KeyValuePairs{{"a", "1"}, {"b", "2"}}},
+	}
+
+	if !reflect.DeepEqual(a.Items, want) {
+		t.Errorf("got %v, want %v", a.Items, want)
+	}
+}
+
+func TestGenerateItemsBatchLargeQuantity(t *testing.T) {
+	defs := testItemDefs(t)
+
+	const quantity = 3 * math.MaxInt32
+	items, err := GenerateItemsBatch(defs, TaggedBundleDefs{{Item: 7000, Quantity: quantity}}, NewRoller(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := int64(0)
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			t.Errorf("item %d has quantity %d", item.Item, item.Quantity)
+		}
+
+		total += item.Quantity
+	}
+
+	// each drop expands into at least one item
+	if total < quantity {
+		t.Errorf("got %d items from %d drops", total, int64(quantity))
+	}
+}
+
+func TestTagsKey(t *testing.T) {
+	tests := []struct {
+		tags KeyValuePairs
+		want string
+	}{
+		{tags: nil, want: ""},
+		{tags: KeyValuePairs{{"strange", "5000"}}, want: "strange:5000"},
+		{tags: KeyValuePairs{{"b", "2"}, {"a", "1"}}, want: "a:1;b:2"},
+		{tags: KeyValuePairs{{"a", "2"}, {"b", "1"}, {"a", "1"}}, want: "a:1;a:2;b:1"},
+		{
+			tags: KeyValuePairs{{"j", ""}, {"i", ""}, {"h", ""}, {"g", ""}, {"f", ""}, {"e", ""}, {"d", ""}, {"c", ""}, {"b", ""}, {"a", ""}},
+			want: "a:;b:;c:;d:;e:;f:;g:;h:;i:;j:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := TagsKey(tt.tags); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			// longer lists are sorted on the heap
+			if len(tt.tags) > 8 {
+				return
+			}
+
+			if allocs := testing.AllocsPerRun(10, func() { TagsKey(tt.tags) }); allocs != 0 {
+				t.Errorf("tagsKey allocates %v times for a tag set it has seen", allocs)
+			}
+		})
+	}
+}
+
+// addMergeItem is the linear search that ItemAggregator replaced, kept to
+// compare against in BenchmarkAddMergeItem.
+func addMergeItem(items TaggedBundleDefs, id int32, quantity int64, tags KeyValuePairs) TaggedBundleDefs {
+	key := TagsKey(tags)
+	for i := range items {
+		if items[i].Item == id && TagsKey(items[i].Tags) == key {
+			items[i].Quantity += quantity
+
+			return items
+		}
+	}
+
+	return append(items, TaggedBundleDef{
+		Item:     id,
+		Quantity: quantity,
+		Tags:     tags,
+	})
+}
+
+func BenchmarkAddMergeItem(b *testing.B) {
+	distinct, err := GenerateItemsBatch(testItemDefs(b), TaggedBundleDefs{{Item: 7000, Quantity: 1000000}}, NewRoller(1))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// add every distinct item several times, with the tags in a different
+	// order each time, like the output of many generator rolls
+	var adds TaggedBundleDefs
+	for round := 0; round < 10; round++ {
+		for _, item := range distinct {
+			r := 0
+			if len(item.Tags) != 0 {
+				r = round % len(item.Tags)
+			}
+
+			tags := append(append(KeyValuePairs(nil), item.Tags[r:]...), item.Tags[:r]...)
+			adds = append(adds, TaggedBundleDef{Item: item.Item, Quantity: 1, Tags: tags})
+		}
+	}
+
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var items TaggedBundleDefs
+			for _, item := range adds {
+				items = addMergeItem(items, item.Item, item.Quantity, item.Tags)
+			}
+		}
+	})
+
+	b.Run("aggregator", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			var items ItemAggregator
+			items.AddAll(adds)
+		}
+	})
+}
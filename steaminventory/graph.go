@@ -0,0 +1,85 @@
+package steaminventory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxExpansionDepth is the number of expansion passes GenerateItems will
+// make before giving up. The loader rejects cycles, so this only matters
+// for item definitions that didn't go through LoadItemDefs.
+var MaxExpansionDepth = 64
+
+// expansionEdges returns the items that def can expand into.
+func expansionEdges(def *ItemDef) []int32 {
+	edges := make([]int32, 0, len(def.Bundle)+len(def.TagGenerators))
+	for _, b := range def.Bundle {
+		edges = append(edges, b.Item)
+	}
+
+	return append(edges, def.TagGenerators...)
+}
+
+// findExpansionCycles reports every cycle in the graph formed by bundle and
+// tag_generators references. ids must be sorted so that the reported cycles
+// are stable between runs.
+func findExpansionCycles(defs map[int32]*ItemDef, ids []int32) []error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[int32]int, len(defs))
+	var path []int32
+	var errs []error
+
+	var visit func(id int32)
+	visit = func(id int32) {
+		def, ok := defs[id]
+		if !ok {
+			// reported by validateItemDef
+			return
+		}
+
+		switch state[id] {
+		case visited:
+			return
+		case visiting:
+			start := len(path) - 1
+			for path[start] != id {
+				start--
+			}
+
+			cycle := make([]string, 0, len(path)-start+1)
+			for _, p := range path[start:] {
+				cycle = append(cycle, fmt.Sprint(p))
+			}
+			cycle = append(cycle, fmt.Sprint(id))
+
+			errs = append(errs, &ValidationError{
+				File: def.File,
+				ID:   id,
+				Msg:  "expansion cycle: " + strings.Join(cycle, " -> "),
+			})
+
+			return
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+
+		for _, next := range expansionEdges(def) {
+			visit(next)
+		}
+
+		path = path[:len(path)-1]
+		state[id] = visited
+	}
+
+	for _, id := range ids {
+		visit(id)
+	}
+
+	return errs
+}
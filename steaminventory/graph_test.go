@@ -0,0 +1,100 @@
+package steaminventory
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFindExpansionCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		defs []*ItemDef
+		want []string
+	}{
+		{
+			name: "no cycle",
+			defs: []*ItemDef{
+				{ID: 1, Type: "item"},
+				{ID: 2, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 1}}},
+				{ID: 3, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 1}, {Item: 2, Quantity: 1}}},
+			},
+		},
+		{
+			name: "missing item",
+			defs: []*ItemDef{
+				{ID: 2, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 1}}},
+			},
+		},
+		{
+			name: "self",
+			defs: []*ItemDef{
+				{ID: 1, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 1}}},
+			},
+			want: []string{"test.json: item 1: expansion cycle: 1 -> 1"},
+		},
+		{
+			name: "two items",
+			defs: []*ItemDef{
+				{ID: 1, Type: "bundle", Bundle: BundleDefs{{Item: 2, Quantity: 1}}},
+				{ID: 2, Type: "generator", Bundle: BundleDefs{{Item: 1, Quantity: 1}}},
+			},
+			want: []string{"test.json: item 1: expansion cycle: 1 -> 2 -> 1"},
+		},
+		{
+			name: "tag_generators",
+			defs: []*ItemDef{
+				{ID: 1, Type: "item", TagGenerators: []int32{2}},
+				{ID: 2, Type: "tag_generator", Bundle: BundleDefs{{Item: 3, Quantity: 1}}},
+				{ID: 3, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 1}}},
+			},
+			want: []string{"test.json: item 1: expansion cycle: 1 -> 2 -> 3 -> 1"},
+		},
+		{
+			name: "two cycles",
+			defs: []*ItemDef{
+				{ID: 1, Type: "bundle", Bundle: BundleDefs{{Item: 2, Quantity: 1}, {Item: 3, Quantity: 1}}},
+				{ID: 2, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 1}}},
+				{ID: 3, Type: "bundle", Bundle: BundleDefs{{Item: 3, Quantity: 1}}},
+			},
+			want: []string{
+				"test.json: item 1: expansion cycle: 1 -> 2 -> 1",
+				"test.json: item 3: expansion cycle: 3 -> 3",
+			},
+		},
+		{
+			name: "cycle below the start",
+			defs: []*ItemDef{
+				{ID: 1, Type: "bundle", Bundle: BundleDefs{{Item: 2, Quantity: 1}}},
+				{ID: 2, Type: "bundle", Bundle: BundleDefs{{Item: 3, Quantity: 1}}},
+				{ID: 3, Type: "bundle", Bundle: BundleDefs{{Item: 2, Quantity: 1}}},
+			},
+			want: []string{"test.json: item 2: expansion cycle: 2 -> 3 -> 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := make(map[int32]*ItemDef, len(tt.defs))
+			ids := make([]int32, 0, len(tt.defs))
+			for _, def := range tt.defs {
+				def.File = "test.json"
+				defs[def.ID] = def
+				ids = append(ids, def.ID)
+			}
+
+			sort.Slice(ids, func(i, j int) bool {
+				return ids[i] < ids[j]
+			})
+
+			var got []string
+			for _, err := range findExpansionCycles(defs, ids) {
+				got = append(got, err.Error())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cycles %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
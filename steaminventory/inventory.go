@@ -0,0 +1,307 @@
+package steaminventory
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// ItemInstance is a single item (or stack of items) in a player's
+// inventory, like an item returned by Steam's GetInventory.
+type ItemInstance struct {
+	ItemID         uint64
+	OriginalItemID uint64
+	Item           int32
+	Quantity       int32
+	Acquired       time.Time
+	State          string
+
+	// how the item was acquired; one of the origin constants
+	Origin string
+
+	// tags added when the item was generated or by tag tools
+	Tags         KeyValuePairs
+	DynamicProps map[string]int64
+}
+
+// item origins reported by the Steam Inventory API
+const (
+	OriginPlaytime = "playtime"
+	OriginExternal = "external"
+	OriginPromo    = "promo"
+	OriginPurchase = "purchase"
+	OriginExchange = "exchange"
+)
+
+// ItemIDAllocator hands out item IDs. Inventories that share an allocator
+// never have colliding item IDs. It is safe to use from multiple goroutines.
+type ItemIDAllocator struct {
+	next uint64
+}
+
+// NewItemIDAllocator returns an allocator whose first item ID is after
+// last.
+func NewItemIDAllocator(last uint64) *ItemIDAllocator {
+	return &ItemIDAllocator{next: last}
+}
+
+func (a *ItemIDAllocator) allocate() uint64 {
+	return atomic.AddUint64(&a.next, 1)
+}
+
+type ItemNotFoundError struct {
+	ItemID uint64
+}
+
+func (e *ItemNotFoundError) Error() string {
+	return fmt.Sprintf("no item with id %d in inventory", e.ItemID)
+}
+
+type InsufficientQuantityError struct {
+	ItemID   uint64
+	Quantity int32
+	Needed   int64
+}
+
+func (e *InsufficientQuantityError) Error() string {
+	return fmt.Sprintf("item %d has quantity %d, but %d is needed", e.ItemID, e.Quantity, e.Needed)
+}
+
+// InvalidQuantityError is returned for a quantity that is not positive or
+// is too large to be the quantity of a stack.
+type InvalidQuantityError struct {
+	ItemID   uint64
+	Quantity int64
+}
+
+func (e *InvalidQuantityError) Error() string {
+	return fmt.Sprintf("invalid quantity %d for item %d", e.Quantity, e.ItemID)
+}
+
+// actions in the inventory event log
+const (
+	EventCreated         = "created"
+	EventConsumed        = "consumed"
+	EventDestroyed       = "destroyed"
+	EventDeviceDestroyed = "device destroyed"
+	EventToolApplied     = "tool applied"
+)
+
+// InventoryEvent records an item that was created or removed by an
+// inventory operation. For EventDeviceDestroyed, ItemID is the item the
+// device was attached to and Item is the device. For EventToolApplied,
+// ItemID is the item the tag tool was applied to, Item is the tool, and
+// Tags and Props are the state of the item after the tool was applied.
+type InventoryEvent struct {
+	Time     time.Time
+	Action   string
+	ItemID   uint64
+	Item     int32
+	Quantity int32
+
+	// state of the item before it was removed, or after it was created
+	Tags  KeyValuePairs
+	Props map[string]int64
+}
+
+type Inventory struct {
+	Items  []*ItemInstance
+	Events []InventoryEvent
+
+	ids *ItemIDAllocator
+}
+
+func NewInventory(ids *ItemIDAllocator) *Inventory {
+	return &Inventory{
+		ids: ids,
+	}
+}
+
+// Find returns the item with the given item ID, or nil if the inventory
+// doesn't contain it.
+func (inv *Inventory) Find(itemID uint64) *ItemInstance {
+	for _, item := range inv.Items {
+		if item.ItemID == itemID {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// Grant adds the output of GenerateItems to the inventory. Items with
+// auto_stack are merged into an existing stack with the same tags, and
+// anything that doesn't fit in a stack's quantity goes into new stacks;
+// every other item gets its own instance per unit, with counters for the
+// devices attached by generated tags. The new or updated instances are
+// returned.
+func (inv *Inventory) Grant(defs map[int32]*ItemDef, items TaggedBundleDefs, acquired time.Time, origin string) []*ItemInstance {
+	var granted []*ItemInstance
+
+	for _, item := range items {
+		def := defs[item.Item]
+		if def.Type != "item" && def.Type != "tag_tool" {
+			panic(fmt.Sprintf("cannot grant item %d of type %s without expanding it", item.Item, def.Type))
+		}
+
+		if def.AutoStack {
+			remaining := item.Quantity
+
+			if stack := inv.findStack(item.Item, item.Tags); stack != nil {
+				add := int64(math.MaxInt32 - stack.Quantity)
+				if add > remaining {
+					add = remaining
+				}
+
+				stack.Quantity += int32(add)
+				remaining -= add
+				granted = append(granted, stack)
+			}
+
+			for remaining > 0 {
+				quantity := remaining
+				if quantity > math.MaxInt32 {
+					quantity = math.MaxInt32
+				}
+
+				granted = append(granted, inv.Add(item.Item, int32(quantity), item.Tags, acquired, origin))
+				remaining -= quantity
+			}
+
+			continue
+		}
+
+		for i := int64(0); i < item.Quantity; i++ {
+			granted = append(granted, inv.Add(item.Item, 1, item.Tags, acquired, origin))
+		}
+	}
+
+	for _, item := range granted {
+		item.initCounters(defs)
+	}
+
+	return granted
+}
+
+// Consume removes quantity from the item with the given item ID. The item
+// is removed from the inventory when none is left.
+func (inv *Inventory) Consume(itemID uint64, quantity int32) error {
+	if quantity <= 0 {
+		return &InvalidQuantityError{ItemID: itemID, Quantity: int64(quantity)}
+	}
+
+	for i, item := range inv.Items {
+		if item.ItemID != itemID {
+			continue
+		}
+
+		if item.Quantity < quantity {
+			return &InsufficientQuantityError{
+				ItemID:   itemID,
+				Quantity: item.Quantity,
+				Needed:   int64(quantity),
+			}
+		}
+
+		item.Quantity -= quantity
+		if item.Quantity == 0 {
+			inv.Items = append(inv.Items[:i], inv.Items[i+1:]...)
+		}
+
+		return nil
+	}
+
+	return &ItemNotFoundError{ItemID: itemID}
+}
+
+// transferQuantity moves quantity from one stack to another stack of the
+// same item with the same tags. If destItemID is 0, the quantity is split
+// off into a new stack instead. The source and destination are returned.
+func (inv *Inventory) transferQuantity(sourceItemID uint64, quantity int32, destItemID uint64) ([]*ItemInstance, error) {
+	source := inv.Find(sourceItemID)
+	if source == nil {
+		return nil, &ItemNotFoundError{ItemID: sourceItemID}
+	}
+
+	if quantity <= 0 || quantity > source.Quantity {
+		return nil, &InsufficientQuantityError{
+			ItemID:   sourceItemID,
+			Quantity: source.Quantity,
+			Needed:   int64(quantity),
+		}
+	}
+
+	var dest *ItemInstance
+	if destItemID == 0 {
+		if quantity == source.Quantity {
+			return nil, fmt.Errorf("cannot split all %d of item %d into a new stack", quantity, sourceItemID)
+		}
+
+		dest = inv.Add(source.Item, 0, source.Tags, source.Acquired, source.Origin)
+		dest.OriginalItemID = source.OriginalItemID
+	} else {
+		dest = inv.Find(destItemID)
+		if dest == nil {
+			return nil, &ItemNotFoundError{ItemID: destItemID}
+		}
+
+		if dest == source || dest.Item != source.Item || TagsKey(dest.Tags) != TagsKey(source.Tags) {
+			return nil, fmt.Errorf("cannot move item %d into item %d: they are not the same item", sourceItemID, destItemID)
+		}
+	}
+
+	if int64(dest.Quantity)+int64(quantity) > math.MaxInt32 {
+		return nil, fmt.Errorf("cannot move %d of item %d into item %d: the stack would hold more than %d", quantity, sourceItemID, destItemID, math.MaxInt32)
+	}
+
+	if err := inv.Consume(sourceItemID, quantity); err != nil {
+		return nil, err
+	}
+
+	dest.Quantity += quantity
+
+	return []*ItemInstance{source, dest}, nil
+}
+
+// findStack returns a stack of the item with the given tags that has room
+// for more, or nil if there isn't one.
+func (inv *Inventory) findStack(id int32, tags KeyValuePairs) *ItemInstance {
+	key := TagsKey(tags)
+
+	for _, item := range inv.Items {
+		if item.Item == id && item.Quantity < math.MaxInt32 && TagsKey(item.Tags) == key {
+			return item
+		}
+	}
+
+	return nil
+}
+
+func (inv *Inventory) Add(id, quantity int32, tags KeyValuePairs, acquired time.Time, origin string) *ItemInstance {
+	itemID := inv.ids.allocate()
+	item := &ItemInstance{
+		ItemID:         itemID,
+		OriginalItemID: itemID,
+		Item:           id,
+		Quantity:       quantity,
+		Acquired:       acquired,
+		Origin:         origin,
+		Tags:           append(KeyValuePairs(nil), tags...),
+	}
+
+	inv.Items = append(inv.Items, item)
+
+	return item
+}
+
+// Bundles summarizes the inventory in the format used by GenerateItems.
+func (inv *Inventory) Bundles() TaggedBundleDefs {
+	var items ItemAggregator
+
+	for _, item := range inv.Items {
+		items.add(item.Item, int64(item.Quantity), item.Tags)
+	}
+
+	return items.Items
+}
@@ -0,0 +1,245 @@
+package steaminventory
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGrant(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item", AutoStack: true},
+		2: {ID: 2, Type: "item"},
+	}
+
+	red := KeyValuePairs{{Key: "color", Value: "red"}}
+
+	tests := []struct {
+		name   string
+		grants []TaggedBundleDefs
+
+		// quantity of each instance, in the order they were added
+		want []int32
+	}{
+		{
+			name:   "auto_stack",
+			grants: []TaggedBundleDefs{{{Item: 1, Quantity: 5}}, {{Item: 1, Quantity: 7}}},
+			want:   []int32{12},
+		},
+		{
+			name:   "auto_stack with other tags",
+			grants: []TaggedBundleDefs{{{Item: 1, Quantity: 5}}, {{Item: 1, Quantity: 7, Tags: red}}},
+			want:   []int32{5, 7},
+		},
+		{
+			name:   "one instance per unit",
+			grants: []TaggedBundleDefs{{{Item: 2, Quantity: 3}}},
+			want:   []int32{1, 1, 1},
+		},
+	}
+
+	acquired := testTime
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := &ItemIDAllocator{}
+			inv := NewInventory(ids)
+			for _, items := range tt.grants {
+				inv.Grant(defs, items, acquired, OriginExternal)
+			}
+
+			if len(inv.Items) != len(tt.want) {
+				t.Fatalf("got %d instances, want %d", len(inv.Items), len(tt.want))
+			}
+
+			seen := make(map[uint64]bool)
+			for i, item := range inv.Items {
+				if item.Quantity != tt.want[i] {
+					t.Errorf("instance %d has quantity %d, want %d", i, item.Quantity, tt.want[i])
+				}
+
+				if seen[item.ItemID] || item.OriginalItemID != item.ItemID {
+					t.Errorf("instance %d has item id %d (original %d)", i, item.ItemID, item.OriginalItemID)
+				}
+				seen[item.ItemID] = true
+
+				if inv.Find(item.ItemID) != item {
+					t.Errorf("find(%d) did not return instance %d", item.ItemID, i)
+				}
+			}
+
+			// another inventory with the same allocator never reuses an id
+			other := NewInventory(ids).Grant(defs, TaggedBundleDefs{{Item: 2, Quantity: 1}}, acquired, OriginExternal)[0]
+			if seen[other.ItemID] {
+				t.Errorf("item id %d was allocated twice", other.ItemID)
+			}
+		})
+	}
+}
+
+func TestGrantSplitsFullStacks(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item", AutoStack: true},
+	}
+
+	tests := []struct {
+		name   string
+		grants []int64
+		want   []int32
+	}{
+		{
+			name:   "fits",
+			grants: []int64{5, 7},
+			want:   []int32{12},
+		},
+		{
+			name:   "too large for one stack",
+			grants: []int64{math.MaxInt32 + 5},
+			want:   []int32{math.MaxInt32, 5},
+		},
+		{
+			name:   "fills the existing stack",
+			grants: []int64{math.MaxInt32 - 1, 3},
+			want:   []int32{math.MaxInt32, 2},
+		},
+		{
+			name:   "several full stacks",
+			grants: []int64{2*math.MaxInt32 + 1},
+			want:   []int32{math.MaxInt32, math.MaxInt32, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory(&ItemIDAllocator{})
+			for _, q := range tt.grants {
+				inv.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: q}}, testTime, OriginExternal)
+			}
+
+			got := make([]int32, len(inv.Items))
+			for i, item := range inv.Items {
+				got[i] = item.Quantity
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got stacks %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got stacks %v, want %v", got, tt.want)
+				}
+			}
+
+			if total := inv.Bundles()[0].Quantity; total != sum(tt.grants) {
+				t.Errorf("bundles counts %d, want %d", total, sum(tt.grants))
+			}
+		})
+	}
+}
+
+func sum(quantities []int64) int64 {
+	total := int64(0)
+	for _, q := range quantities {
+		total += q
+	}
+
+	return total
+}
+
+func TestConsume(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item", AutoStack: true},
+	}
+
+	tests := []struct {
+		name     string
+		quantity int32
+		missing  bool
+		err      error
+		want     int32
+	}{
+		{name: "some", quantity: 2, want: 3},
+		{name: "all", quantity: 5, want: 0},
+		{name: "none", quantity: 0, err: &InvalidQuantityError{}, want: 5},
+		{name: "negative", quantity: -1, err: &InvalidQuantityError{}, want: 5},
+		{name: "too many", quantity: 6, err: &InsufficientQuantityError{}, want: 5},
+		{name: "missing item", quantity: 1, missing: true, err: &ItemNotFoundError{}, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory(&ItemIDAllocator{})
+			stack := inv.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: 5}}, testTime, OriginExternal)[0]
+
+			itemID := stack.ItemID
+			if tt.missing {
+				itemID++
+			}
+
+			err := inv.Consume(itemID, tt.quantity)
+			if tt.err == nil && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != nil && (err == nil || reflect.TypeOf(err) != reflect.TypeOf(tt.err)) {
+				t.Fatalf("got error %v, want %T", err, tt.err)
+			}
+
+			if stack.Quantity != tt.want {
+				t.Errorf("stack has %d, want %d", stack.Quantity, tt.want)
+			}
+
+			if removed := len(inv.Items) == 0; removed != (tt.want == 0) {
+				t.Errorf("stack removed: %v, want %v", removed, tt.want == 0)
+			}
+		})
+	}
+}
+
+func TestTransferQuantityOverflow(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item", AutoStack: true},
+	}
+
+	inv := NewInventory(&ItemIDAllocator{})
+	inv.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: math.MaxInt32 + 10}}, testTime, OriginExternal)
+
+	full, rest := inv.Items[0], inv.Items[1]
+	if _, err := inv.transferQuantity(rest.ItemID, 5, full.ItemID); err == nil {
+		t.Error("moving into a full stack succeeded")
+	}
+
+	if full.Quantity != math.MaxInt32 || rest.Quantity != 10 {
+		t.Errorf("quantities changed to %d and %d", full.Quantity, rest.Quantity)
+	}
+}
+
+func TestExchangeItemsQuantityOverflow(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item", AutoStack: true},
+		2: {ID: 2, Type: "item", Exchange: ExchangeRecipes{{{Item: 1, Quantity: 2}}}},
+	}
+
+	inv := NewInventory(&ItemIDAllocator{})
+	inv.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: 2}}, testTime, OriginExternal)
+	itemID := inv.Items[0].ItemID
+
+	// the two quantities add up to 2 in int32
+	materials := []ExchangeMaterial{
+		{ItemID: itemID, Quantity: math.MaxInt32},
+		{ItemID: itemID, Quantity: math.MaxInt32},
+		{ItemID: itemID, Quantity: 4},
+	}
+
+	_, err := inv.exchangeItems(defs, materials, 2, NewRoller(1), testTime)
+
+	var insufficient *InsufficientQuantityError
+	if !errors.As(err, &insufficient) {
+		t.Fatalf("got error %v, want InsufficientQuantityError", err)
+	}
+
+	if len(inv.Items) != 1 || inv.Items[0].Quantity != 2 {
+		t.Errorf("inventory changed: %v", inv.Items)
+	}
+}
@@ -0,0 +1,119 @@
+package steaminventory
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Languages lists the Steam API language names that item definitions can
+// have translations for.
+var Languages = []string{
+	"brazilian",
+	"czech",
+	"danish",
+	"dutch",
+	"english",
+	"finnish",
+	"french",
+	"german",
+	"hungarian",
+	"italian",
+	"japanese",
+	"koreana",
+	"norwegian",
+	"polish",
+	"portuguese",
+	"romanian",
+	"russian",
+	"schinese",
+	"spanish",
+	"swedish",
+	"tchinese",
+	"thai",
+	"turkish",
+	"ukrainian",
+}
+
+func IsLanguage(lang string) bool {
+	for _, l := range Languages {
+		if l == lang {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LocalizedBases are the JSON names of the ItemDef fields that have
+// per-language variants.
+var LocalizedBases = []string{"name", "description", "display_type", "accessory_description"}
+
+// LocalizedFields maps the JSON names of the LocalizedBases and of each of
+// their per-language variants that ItemDef has to their field indices.
+var LocalizedFields = func() map[string]int {
+	fields := make(map[string]int)
+
+	t := reflect.TypeOf(ItemDef{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if isLocalizedField(name) {
+			fields[name] = i
+		}
+	}
+
+	return fields
+}()
+
+func isLocalizedField(name string) bool {
+	for _, base := range LocalizedBases {
+		if name == base {
+			return true
+		}
+
+		if lang, ok := strings.CutPrefix(name, base+"_"); ok && IsLanguage(lang) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Localized returns the translation of the field with the JSON name base
+// into lang. Like Steam, it falls back to the English translation and then
+// to the untranslated field.
+func (def *ItemDef) Localized(base, lang string) string {
+	for _, name := range []string{base + "_" + lang, base + "_english", base} {
+		if s := def.LocalizedField(name); s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// LocalizedField returns the field in LocalizedFields with the given JSON
+// name, or an empty string if there is no such field.
+func (def *ItemDef) LocalizedField(name string) string {
+	i, ok := LocalizedFields[name]
+	if !ok {
+		return ""
+	}
+
+	return reflect.ValueOf(def).Elem().Field(i).String()
+}
+
+func (def *ItemDef) LocalizedName(lang string) string {
+	return def.Localized("name", lang)
+}
+
+func (def *ItemDef) LocalizedDescription(lang string) string {
+	return def.Localized("description", lang)
+}
+
+func (def *ItemDef) LocalizedDisplayType(lang string) string {
+	return def.Localized("display_type", lang)
+}
+
+func (def *ItemDef) LocalizedAccessoryDescription(lang string) string {
+	return def.Localized("accessory_description", lang)
+}
@@ -0,0 +1,69 @@
+package steaminventory
+
+import (
+	"testing"
+)
+
+func TestLocalized(t *testing.T) {
+	def := &ItemDef{
+		Name:        "Hat",
+		NameEnglish: "English Hat",
+		NameGerman:  "Hut",
+
+		DisplayType: "Cosmetic",
+
+		DescriptionGerman: "Ein Hut",
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "translated", got: def.LocalizedName("german"), want: "Hut"},
+		{name: "english fallback", got: def.LocalizedName("french"), want: "English Hat"},
+		{name: "english", got: def.LocalizedName("english"), want: "English Hat"},
+		{name: "untranslated fallback", got: def.LocalizedDisplayType("german"), want: "Cosmetic"},
+		{name: "no english or untranslated field", got: def.LocalizedDescription("french"), want: ""},
+		{name: "missing field", got: def.LocalizedAccessoryDescription("german"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguagesHaveFields(t *testing.T) {
+	// every language must have a field for each fully translated family,
+	// or localized would silently skip to English
+	for _, lang := range Languages {
+		for _, base := range []string{"name", "description", "accessory_description"} {
+			if _, ok := LocalizedFields[base+"_"+lang]; !ok {
+				t.Errorf("ItemDef has no %s_%s field", base, lang)
+			}
+		}
+	}
+}
+
+func TestLocalizedFields(t *testing.T) {
+	for _, name := range []string{"name", "name_german", "description_english", "display_type_russian", "accessory_description_koreana"} {
+		if _, ok := LocalizedFields[name]; !ok {
+			t.Errorf("LocalizedFields is missing %s", name)
+		}
+	}
+
+	for _, name := range []string{"type", "icon_url", "promo", "accessory_tag", "after_description", "translator_note", "display_type_french"} {
+		if _, ok := LocalizedFields[name]; ok {
+			t.Errorf("LocalizedFields has %s, which is not localized", name)
+		}
+	}
+
+	def := &ItemDef{Type: "item", Promo: "manual"}
+	if got := def.Localized("type", "english"); got != "" {
+		t.Errorf("Localized(type) = %q, want no translation", got)
+	}
+}
@@ -0,0 +1,235 @@
+package steaminventory
+
+import (
+	"math"
+)
+
+// BatchRollThreshold is the largest count that multinomial rolls one unit
+// at a time instead of drawing binomial samples.
+const BatchRollThreshold = 16
+
+// BatchRollN is the n of the rolls made when drawing binomial samples. Each
+// of these rolls is a uniformly distributed number in [0, 1) scaled by
+// BatchRollN rather than a choice between weighted options.
+const BatchRollN = 1 << 53
+
+// rollFloat returns a uniformly distributed number in [0, 1).
+func rollFloat(r Roller, id int32) float64 {
+	return float64(r.Roll(id, BatchRollN)) / BatchRollN
+}
+
+// multinomial splits n trials between options with the given weights, with
+// the same distribution as rolling each trial separately.
+func multinomial(r Roller, id int32, n int64, weights []int64) []int64 {
+	counts := make([]int64, len(weights))
+
+	totalWeight := int64(0)
+	for _, w := range weights {
+		totalWeight += w
+	}
+
+	if n <= BatchRollThreshold {
+		for i := int64(0); i < n; i++ {
+			weight := r.Roll(id, totalWeight)
+			for j, w := range weights {
+				weight -= w
+				if weight < 0 {
+					counts[j]++
+					break
+				}
+			}
+		}
+
+		return counts
+	}
+
+	// each option's count is binomial given the trials left over from the
+	// options before it
+	remaining := n
+	remainingWeight := totalWeight
+	for i, w := range weights {
+		if remaining == 0 {
+			break
+		}
+
+		if w == remainingWeight {
+			counts[i] = remaining
+
+			break
+		}
+
+		counts[i] = binomial(r, id, remaining, float64(w)/float64(remainingWeight))
+		remaining -= counts[i]
+		remainingWeight -= w
+	}
+
+	return counts
+}
+
+// binomial returns the number of successes in n trials with success
+// probability p.
+func binomial(r Roller, id int32, n int64, p float64) int64 {
+	if p <= 0 || n == 0 {
+		return 0
+	}
+
+	if p >= 1 {
+		return n
+	}
+
+	if p > 0.5 {
+		return n - binomial(r, id, n, 1-p)
+	}
+
+	if float64(n)*p < 30 {
+		return binomialInversion(r, id, n, p)
+	}
+
+	return binomialBTPE(r, id, n, p)
+}
+
+// binomialInversion samples by sequential search; it is fast when n*p is
+// small. p must be at most 0.5.
+func binomialInversion(r Roller, id int32, n int64, p float64) int64 {
+	q := 1 - p
+	qn := math.Exp(float64(n) * math.Log(q))
+	np := float64(n) * p
+	bound := math.Min(float64(n), np+10*math.Sqrt(np*q+1))
+
+	x := int64(0)
+	px := qn
+	u := rollFloat(r, id)
+
+	for u > px {
+		x++
+		if float64(x) > bound {
+			x = 0
+			px = qn
+			u = rollFloat(r, id)
+		} else {
+			u -= px
+			px = float64(n-x+1) * p * px / (float64(x) * q)
+		}
+	}
+
+	return x
+}
+
+// binomialBTPE is the BTPE algorithm from Kachitvichyanukul and Schmeiser,
+// "Binomial Random Variate Generation" (1988). p must be at most 0.5 and
+// n*p should be at least 30.
+func binomialBTPE(r Roller, id int32, n int64, p float64) int64 {
+	nf := float64(n)
+	q := 1 - p
+	fm := nf*p + p
+	m := math.Floor(fm)
+	p1 := math.Floor(2.195*math.Sqrt(nf*p*q)-4.6*q) + 0.5
+	xm := m + 0.5
+	xl := xm - p1
+	xr := xm + p1
+	c := 0.134 + 20.5/(15.3+m)
+	a := (fm - xl) / (fm - xl*p)
+	laml := a * (1 + a/2)
+	a = (xr - fm) / (xr * q)
+	lamr := a * (1 + a/2)
+	p2 := p1 * (1 + 2*c)
+	p3 := p2 + c/laml
+	p4 := p3 + c/lamr
+	nrq := nf * p * q
+
+	for {
+		u := rollFloat(r, id) * p4
+		v := rollFloat(r, id)
+
+		var y float64
+		switch {
+		case u <= p1:
+			// triangular region; always accepted
+			return int64(math.Floor(xm - p1*v + u))
+		case u <= p2:
+			// parallelogram region
+			x := xl + (u-p1)/c
+			v = v*c + 1 - math.Abs(m-x+0.5)/p1
+			if v > 1 {
+				continue
+			}
+
+			y = math.Floor(x)
+		case u <= p3:
+			// left exponential tail
+			if v == 0 {
+				continue
+			}
+
+			y = math.Floor(xl + math.Log(v)/laml)
+			if y < 0 {
+				continue
+			}
+
+			v = v * (u - p2) * laml
+		default:
+			// right exponential tail
+			if v == 0 {
+				continue
+			}
+
+			y = math.Floor(xr - math.Log(v)/lamr)
+			if y > nf {
+				continue
+			}
+
+			v = v * (u - p3) * lamr
+		}
+
+		k := math.Abs(y - m)
+		if k <= 20 || k >= nrq/2-1 {
+			// evaluate f(y)/f(m) directly
+			s := p / q
+			a := s * (nf + 1)
+			f := 1.0
+			if m < y {
+				for i := m + 1; i <= y; i++ {
+					f *= a/i - s
+				}
+			} else if m > y {
+				for i := y + 1; i <= m; i++ {
+					f /= a/i - s
+				}
+			}
+
+			if v > f {
+				continue
+			}
+
+			return int64(y)
+		}
+
+		// squeeze using upper and lower bounds on log(f(y))
+		rho := (k / nrq) * ((k*(k/3+0.625)+0.16666666666666666)/nrq + 0.5)
+		t := -k * k / (2 * nrq)
+		logV := math.Log(v)
+		if logV < t-rho {
+			return int64(y)
+		}
+		if logV > t+rho {
+			continue
+		}
+
+		// final acceptance test using Stirling's formula
+		x1 := y + 1
+		f1 := m + 1
+		z := nf + 1 - m
+		w := nf - y + 1
+		if logV > xm*math.Log(f1/x1)+(nf-m+0.5)*math.Log(z/w)+(y-m)*math.Log(w*p/(x1*q))+stirlingCorrection(f1)+stirlingCorrection(z)+stirlingCorrection(x1)+stirlingCorrection(w) {
+			continue
+		}
+
+		return int64(y)
+	}
+}
+
+func stirlingCorrection(x float64) float64 {
+	x2 := x * x
+
+	return (13680 - (462-(132-(99-140/x2)/x2)/x2)/x2) / x / 166320
+}
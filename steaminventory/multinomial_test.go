@@ -0,0 +1,202 @@
+package steaminventory
+
+import (
+	"math"
+	"testing"
+)
+
+// sampleStats returns the mean and the unbiased variance of samples.
+func sampleStats(samples []float64) (mean, variance float64) {
+	for _, x := range samples {
+		mean += x
+	}
+	mean /= float64(len(samples))
+
+	for _, x := range samples {
+		variance += (x - mean) * (x - mean)
+	}
+	variance /= float64(len(samples) - 1)
+
+	return mean, variance
+}
+
+// checkMoments fails the test if samples don't look like they come from a
+// distribution with the given mean and variance. The sample mean must be
+// within 5 standard errors, and the sample variance within 5 standard
+// errors of a normal distribution's sample variance. The samples come from
+// fixed seeds, so the test is deterministic; the bounds only decide how
+// unlucky a seed is allowed to be.
+func checkMoments(t *testing.T, what string, samples []float64, mean, variance float64) {
+	t.Helper()
+
+	gotMean, gotVariance := sampleStats(samples)
+	k := float64(len(samples))
+
+	if se := math.Sqrt(variance / k); math.Abs(gotMean-mean) > 5*se+1e-9 {
+		t.Errorf("%s: mean %g, want %g (standard error %g)", what, gotMean, mean, se)
+	}
+
+	if se := variance * math.Sqrt(2/(k-1)); math.Abs(gotVariance-variance) > 5*se+1e-9 {
+		t.Errorf("%s: variance %g, want %g (standard error %g)", what, gotVariance, variance, se)
+	}
+}
+
+func TestBinomial(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int64
+		p    float64
+	}{
+		{name: "inversion", n: 40, p: 0.1},
+		{name: "inversion small p", n: 1000, p: 0.001},
+		{name: "BTPE", n: 1000, p: 0.3},
+		{name: "BTPE large n", n: 100000000, p: 0.0001},
+		{name: "BTPE p=0.5", n: 5000, p: 0.5},
+		{name: "mirrored inversion", n: 50, p: 0.95},
+		{name: "mirrored BTPE", n: 10000, p: 0.8},
+	}
+
+	const samples = 20000
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRoller(1)
+
+			got := make([]float64, samples)
+			for i := range got {
+				x := binomial(r, 0, tt.n, tt.p)
+				if x < 0 || x > tt.n {
+					t.Fatalf("sample %d is %d, outside [0, %d]", i, x, tt.n)
+				}
+
+				got[i] = float64(x)
+			}
+
+			nf := float64(tt.n)
+			checkMoments(t, "binomial", got, nf*tt.p, nf*tt.p*(1-tt.p))
+		})
+	}
+}
+
+func TestMultinomial(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int64
+		weights []int64
+	}{
+		{name: "unit rolls", n: BatchRollThreshold, weights: []int64{1, 2, 3}},
+		{name: "binomial", n: 100000, weights: []int64{10000, 1500, 50}},
+		{name: "zero weight", n: 1000, weights: []int64{1, 0, 1}},
+	}
+
+	const samples = 5000
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRoller(1)
+
+			totalWeight := int64(0)
+			for _, w := range tt.weights {
+				totalWeight += w
+			}
+
+			got := make([][]float64, len(tt.weights))
+			for i := 0; i < samples; i++ {
+				counts := multinomial(r, 0, tt.n, tt.weights)
+
+				total := int64(0)
+				for j, c := range counts {
+					total += c
+					got[j] = append(got[j], float64(c))
+				}
+
+				if total != tt.n {
+					t.Fatalf("counts %v add up to %d, want %d", counts, total, tt.n)
+				}
+			}
+
+			for j, w := range tt.weights {
+				p := float64(w) / float64(totalWeight)
+				nf := float64(tt.n)
+				checkMoments(t, "option "+string(rune('0'+j)), got[j], nf*p, nf*p*(1-p))
+			}
+		})
+	}
+}
+
+// TestGenerateItemsBatchDistribution checks that rolling each unit and
+// rolling all units at once give every outcome the mean and variance
+// calculated by DropProbabilities.
+func TestGenerateItemsBatchDistribution(t *testing.T) {
+	tests := []struct {
+		name string
+		root int32
+	}{
+		{name: "drop pool", root: 7000},
+		{name: "tag_generator", root: 6000},
+	}
+
+	const (
+		units = 1000
+		runs  = 200
+	)
+
+	defs := testItemDefs(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcomes, err := DropProbabilities(defs, tt.root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, batch := range []bool{false, true} {
+				counts := make(map[itemKey][]float64)
+				for run := 0; run < runs; run++ {
+					items, err := expandItems(defs, TaggedBundleDefs{{Item: tt.root, Quantity: units}}, NewRoller(int64(run)), batch)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					for _, item := range items {
+						key := itemKey{item: item.Item, tags: TagsKey(item.Tags)}
+						if counts[key] == nil {
+							counts[key] = make([]float64, runs)
+						}
+
+						counts[key][run] = float64(item.Quantity)
+					}
+				}
+
+				for _, outcome := range outcomes {
+					key := itemKey{item: outcome.Item, tags: TagsKey(outcome.Tags)}
+
+					mean, _ := outcome.Expected.Float64()
+					square := 0.0
+					for q, p := range outcome.Distribution {
+						pf, _ := p.Float64()
+						square += float64(q*q) * pf
+					}
+					variance := square - mean*mean
+
+					// rare outcomes are too lumpy for the normal bounds
+					if mean*units < 20 {
+						continue
+					}
+
+					got := counts[key]
+					if got == nil {
+						got = make([]float64, runs)
+					}
+
+					what := "per-unit"
+					if batch {
+						what = "batch"
+					}
+
+					checkMoments(t, what+" "+key.tags, got, mean*units, variance*units)
+				}
+			}
+		})
+	}
+}
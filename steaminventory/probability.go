@@ -0,0 +1,279 @@
+package steaminventory
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// QuantityDistribution maps a quantity to the probability of receiving
+// exactly that many of an item. Probabilities sum to 1, including the
+// probability of receiving none.
+type QuantityDistribution map[int64]*big.Rat
+
+type DropOutcome struct {
+	Item int32
+	Tags KeyValuePairs
+
+	// chance of receiving at least one
+	Probability *big.Rat
+	// mean quantity received
+	Expected     *big.Rat
+	Distribution QuantityDistribution
+}
+
+type DropOutcomes []*DropOutcome
+
+// DropProbabilities computes the exact distribution of everything a single
+// unit of root expands into. Generator options and tag generator values are
+// weighted as in GenerateItems; bundles multiply their contents.
+func DropProbabilities(defs map[int32]*ItemDef, root int32) (DropOutcomes, error) {
+	def, ok := defs[root]
+	if !ok {
+		return nil, fmt.Errorf("item %d does not exist", root)
+	}
+
+	if err := CheckExpandable(def); err != nil {
+		return nil, err
+	}
+
+	c := &probabilityCalculator{
+		defs: defs,
+		memo: make(map[string]outcomeDistributions),
+	}
+
+	var outcomes DropOutcomes
+	for _, od := range c.expand(root, nil) {
+		outcome := &DropOutcome{
+			Item:         od.item,
+			Tags:         od.tags,
+			Probability:  new(big.Rat).Sub(big.NewRat(1, 1), od.dist.probability(0)),
+			Expected:     new(big.Rat),
+			Distribution: od.dist,
+		}
+
+		for q, p := range od.dist {
+			outcome.Expected.Add(outcome.Expected, new(big.Rat).Mul(big.NewRat(q, 1), p))
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	sort.Slice(outcomes, func(i, j int) bool {
+		if c := outcomes[i].Expected.Cmp(outcomes[j].Expected); c != 0 {
+			return c > 0
+		}
+
+		if outcomes[i].Item != outcomes[j].Item {
+			return outcomes[i].Item < outcomes[j].Item
+		}
+
+		return TagsKey(outcomes[i].Tags) < TagsKey(outcomes[j].Tags)
+	})
+
+	return outcomes, nil
+}
+
+type outcomeDistribution struct {
+	item int32
+	tags KeyValuePairs
+	dist QuantityDistribution
+}
+
+// keyed by outcomeKey
+type outcomeDistributions map[string]*outcomeDistribution
+
+type probabilityCalculator struct {
+	defs map[int32]*ItemDef
+	memo map[string]outcomeDistributions
+}
+
+func (c *probabilityCalculator) expand(id int32, tags KeyValuePairs) outcomeDistributions {
+	key := outcomeKey(id, tags)
+	if result, ok := c.memo[key]; ok {
+		return result
+	}
+
+	def := c.defs[id]
+	var result outcomeDistributions
+
+	switch def.Type {
+	case "item", "tag_tool":
+		result = outcomeDistributions{
+			key: {
+				item: id,
+				tags: tags,
+				dist: QuantityDistribution{1: big.NewRat(1, 1)},
+			},
+		}
+	case "playtimegenerator", "generator":
+		totalWeight := int64(0)
+		for _, option := range def.Bundle {
+			totalWeight += int64(option.Quantity)
+		}
+
+		var children []outcomeDistributions
+		var weights []*big.Rat
+
+		for _, combo := range c.tagCombinations(def.TagGenerators) {
+			childTags := append(append(KeyValuePairs(nil), tags...), combo.tags...)
+
+			for _, option := range def.Bundle {
+				children = append(children, c.expand(option.Item, childTags))
+				weights = append(weights, new(big.Rat).Mul(combo.weight, big.NewRat(int64(option.Quantity), totalWeight)))
+			}
+		}
+
+		result = mixOutcomes(children, weights)
+	case "bundle":
+		result = make(outcomeDistributions)
+
+		for _, b := range def.Bundle {
+			for k, od := range c.expand(b.Item, tags) {
+				dist := od.dist.pow(int64(b.Quantity))
+				if existing, ok := result[k]; ok {
+					dist = existing.dist.convolve(dist)
+				}
+
+				result[k] = &outcomeDistribution{
+					item: od.item,
+					tags: od.tags,
+					dist: dist,
+				}
+			}
+		}
+	default:
+		// the loader only allows expandable items in bundles, and
+		// DropProbabilities checks the root
+		panic("unhandled item type: " + def.Type)
+	}
+
+	c.memo[key] = result
+
+	return result
+}
+
+type tagCombination struct {
+	tags   KeyValuePairs
+	weight *big.Rat
+}
+
+// tagCombinations returns every set of tags the given tag generators can
+// produce, in generation order, with the probability of each.
+func (c *probabilityCalculator) tagCombinations(tagGenerators IDList) []tagCombination {
+	combos := []tagCombination{{weight: big.NewRat(1, 1)}}
+
+	for _, tgid := range tagGenerators {
+		tgdef := c.defs[tgid]
+
+		totalTagWeight := int64(0)
+		for _, option := range tgdef.TagGeneratorValues {
+			totalTagWeight += int64(option.Weight)
+		}
+
+		next := make([]tagCombination, 0, len(combos)*len(tgdef.TagGeneratorValues))
+		for _, combo := range combos {
+			for _, option := range tgdef.TagGeneratorValues {
+				next = append(next, tagCombination{
+					tags: append(append(KeyValuePairs(nil), combo.tags...), KeyValuePair{
+						Key:   tgdef.TagGeneratorName,
+						Value: option.Value,
+					}),
+					weight: new(big.Rat).Mul(combo.weight, big.NewRat(int64(option.Weight), totalTagWeight)),
+				})
+			}
+		}
+
+		combos = next
+	}
+
+	return combos
+}
+
+// mixOutcomes returns the distribution of picking exactly one of children,
+// where child i is picked with probability weights[i].
+func mixOutcomes(children []outcomeDistributions, weights []*big.Rat) outcomeDistributions {
+	result := make(outcomeDistributions)
+
+	for _, child := range children {
+		for k, od := range child {
+			if _, ok := result[k]; !ok {
+				result[k] = &outcomeDistribution{
+					item: od.item,
+					tags: od.tags,
+					dist: make(QuantityDistribution),
+				}
+			}
+		}
+	}
+
+	for k, od := range result {
+		for i, child := range children {
+			if cod, ok := child[k]; ok {
+				od.dist.addScaled(cod.dist, weights[i])
+			} else {
+				od.dist.addScaled(QuantityDistribution{0: big.NewRat(1, 1)}, weights[i])
+			}
+		}
+	}
+
+	return result
+}
+
+func (d QuantityDistribution) probability(q int64) *big.Rat {
+	if p, ok := d[q]; ok {
+		return p
+	}
+
+	return new(big.Rat)
+}
+
+func (d QuantityDistribution) addScaled(other QuantityDistribution, scale *big.Rat) {
+	for q, p := range other {
+		if _, ok := d[q]; !ok {
+			d[q] = new(big.Rat)
+		}
+
+		d[q].Add(d[q], new(big.Rat).Mul(p, scale))
+	}
+}
+
+// convolve returns the distribution of the sum of independent draws from d
+// and other.
+func (d QuantityDistribution) convolve(other QuantityDistribution) QuantityDistribution {
+	result := make(QuantityDistribution, len(d)+len(other))
+
+	for q1, p1 := range d {
+		for q2, p2 := range other {
+			if _, ok := result[q1+q2]; !ok {
+				result[q1+q2] = new(big.Rat)
+			}
+
+			result[q1+q2].Add(result[q1+q2], new(big.Rat).Mul(p1, p2))
+		}
+	}
+
+	return result
+}
+
+// pow returns the distribution of the sum of n independent draws from d.
+func (d QuantityDistribution) pow(n int64) QuantityDistribution {
+	result := QuantityDistribution{0: big.NewRat(1, 1)}
+
+	for base := d; n != 0; n >>= 1 {
+		if n&1 != 0 {
+			result = result.convolve(base)
+		}
+
+		if n > 1 {
+			base = base.convolve(base)
+		}
+	}
+
+	return result
+}
+
+func outcomeKey(id int32, tags KeyValuePairs) string {
+	return strconv.FormatInt(int64(id), 10) + "|" + TagsKey(tags)
+}
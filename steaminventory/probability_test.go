@@ -0,0 +1,105 @@
+package steaminventory
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestDropProbabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		root int32
+		err  bool
+	}{
+		{name: "playtimegenerator", root: 7000},
+		{name: "item", root: 4001},
+		{name: "tag_generator", root: 6001, err: true},
+		{name: "unknown item", root: 99999, err: true},
+	}
+
+	defs := testItemDefs(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcomes, err := DropProbabilities(defs, tt.root)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %d outcomes, want an error", len(outcomes))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(outcomes) == 0 {
+				t.Fatal("no outcomes")
+			}
+
+			one := big.NewRat(1, 1)
+			for _, outcome := range outcomes {
+				total := new(big.Rat)
+				for _, p := range outcome.Distribution {
+					total.Add(total, p)
+				}
+
+				if total.Cmp(one) != 0 {
+					t.Errorf("distribution of item %d %v adds up to %s", outcome.Item, outcome.Tags, total.RatString())
+				}
+			}
+		})
+	}
+}
+
+func TestDropProbabilitiesExact(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item"},
+		2: {ID: 2, Type: "item"},
+		3: {ID: 3, Type: "bundle", Bundle: BundleDefs{{Item: 2, Quantity: 2}}},
+		4: {ID: 4, Type: "generator", Bundle: BundleDefs{{Item: 1, Quantity: 1}, {Item: 3, Quantity: 3}}},
+	}
+
+	tests := []struct {
+		item        int32
+		probability string
+		expected    string
+		quantities  map[int64]string
+	}{
+		{item: 2, probability: "3/4", expected: "3/2", quantities: map[int64]string{0: "1/4", 2: "3/4"}},
+		{item: 1, probability: "1/4", expected: "1/4", quantities: map[int64]string{0: "3/4", 1: "1/4"}},
+	}
+
+	outcomes, err := DropProbabilities(defs, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outcomes) != len(tests) {
+		t.Fatalf("got %d outcomes, want %d", len(outcomes), len(tests))
+	}
+
+	for i, tt := range tests {
+		outcome := outcomes[i]
+		if outcome.Item != tt.item {
+			t.Errorf("outcome %d is item %d, want %d", i, outcome.Item, tt.item)
+
+			continue
+		}
+
+		if got := outcome.Probability.RatString(); got != tt.probability {
+			t.Errorf("item %d: probability %s, want %s", tt.item, got, tt.probability)
+		}
+
+		if got := outcome.Expected.RatString(); got != tt.expected {
+			t.Errorf("item %d: expected quantity %s, want %s", tt.item, got, tt.expected)
+		}
+
+		for q, want := range tt.quantities {
+			if got := outcome.Distribution.probability(q).RatString(); got != want {
+				t.Errorf("item %d: probability of %d is %s, want %s", tt.item, q, got, want)
+			}
+		}
+	}
+}
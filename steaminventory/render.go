@@ -0,0 +1,153 @@
+package steaminventory
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PlaceholderPattern matches a %placeholder% in a description.
+var PlaceholderPattern = regexp.MustCompile(`%[A-Za-z0-9_]+%`)
+
+// UndeclaredPropertyError is reported when a description template uses a
+// dynamic property that is not in the compressed_dynamic_props of the item
+// the template belongs to.
+type UndeclaredPropertyError struct {
+	Item     int32
+	Field    string
+	Property string
+}
+
+func (e *UndeclaredPropertyError) Error() string {
+	return fmt.Sprintf("item %d: %s uses undeclared dynamic property %s", e.Item, e.Field, e.Property)
+}
+
+// RenderDescription returns the text a player sees for item: its
+// description, its after_description, and the accessory description of
+// every tag tool attached to it, with %property% placeholders replaced by
+// the item's dynamic properties. Placeholders for undeclared properties are
+// left as they are and reported in the error.
+func RenderDescription(defs map[int32]*ItemDef, item *ItemInstance, lang string) (string, error) {
+	def, ok := defs[item.Item]
+	if !ok {
+		return "", fmt.Errorf("cannot render the description of unknown item %d", item.Item)
+	}
+
+	var lines []string
+	var errs []error
+	add := func(source *ItemDef, field, template string) {
+		if template == "" {
+			return
+		}
+
+		lines = append(lines, PlaceholderPattern.ReplaceAllStringFunc(template, func(token string) string {
+			name := strings.Trim(token, "%")
+			if !DeclaresProperty(source, name) {
+				errs = append(errs, &UndeclaredPropertyError{
+					Item:     source.ID,
+					Field:    field,
+					Property: name,
+				})
+
+				return token
+			}
+
+			return strconv.FormatInt(item.dynamicProp(name), 10)
+		}))
+	}
+
+	add(def, "description", def.LocalizedDescription(lang))
+	add(def, "after_description", def.AfterDescription)
+
+	for _, tool := range attachedTools(defs, def, item.Tags) {
+		add(tool, "accessory_description", tool.LocalizedAccessoryDescription(lang))
+	}
+
+	return strings.Join(lines, "\n"), errors.Join(errs...)
+}
+
+// attachedTools returns the tag tools named by def's accessory tag in the
+// definition and instance tags.
+func attachedTools(defs map[int32]*ItemDef, def *ItemDef, tags KeyValuePairs) []*ItemDef {
+	if def.AccessoryTag == "" {
+		return nil
+	}
+
+	var tools []*ItemDef
+	for _, kv := range append(append(KeyValuePairs(nil), def.Tags...), tags...) {
+		if kv.Key != def.AccessoryTag {
+			continue
+		}
+
+		id, err := strconv.ParseInt(kv.Value, 10, 32)
+		if err != nil {
+			continue
+		}
+
+		if tool, ok := defs[int32(id)]; ok {
+			tools = append(tools, tool)
+		}
+	}
+
+	return tools
+}
+
+func DeclaresProperty(def *ItemDef, name string) bool {
+	for _, prop := range def.CompressedDynamicProps {
+		if prop == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dynamicProp returns the value of a dynamic property. m_unQuantity is the
+// stack size unless it has been set explicitly; other properties start at 0.
+func (item *ItemInstance) dynamicProp(name string) int64 {
+	if value, ok := item.DynamicProps[name]; ok {
+		return value
+	}
+
+	if name == "m_unQuantity" {
+		return int64(item.Quantity)
+	}
+
+	return 0
+}
+
+// undeclaredProperties checks every description template of def, in every
+// language, for properties def doesn't declare.
+func undeclaredProperties(def *ItemDef) []*UndeclaredPropertyError {
+	templates := map[string]string{"after_description": def.AfterDescription}
+	for name := range LocalizedFields {
+		if strings.HasPrefix(name, "description") || strings.HasPrefix(name, "accessory_description") {
+			templates[name] = def.LocalizedField(name)
+		}
+	}
+
+	fields := make([]string, 0, len(templates))
+	for name := range templates {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	var errs []*UndeclaredPropertyError
+	for _, field := range fields {
+		for _, token := range PlaceholderPattern.FindAllString(templates[field], -1) {
+			name := strings.Trim(token, "%")
+			if !DeclaresProperty(def, name) {
+				errs = append(errs, &UndeclaredPropertyError{
+					Item:     def.ID,
+					Field:    field,
+					Property: name,
+				})
+			}
+		}
+	}
+
+	return errs
+}
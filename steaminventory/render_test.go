@@ -0,0 +1,132 @@
+package steaminventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRenderDescription(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {
+			ID:                     1,
+			Type:                   "item",
+			Description:            "Killed %kills% aliens.",
+			DescriptionGerman:      "%kills% Aliens getötet.",
+			AfterDescription:       "Stack of %m_unQuantity%.",
+			AccessoryTag:           "sticker",
+			CompressedDynamicProps: StringList{"kills", "m_unQuantity"},
+		},
+		2: {ID: 2, Type: "tag_tool", AccessoryDescription: "Sticker applied %times% times.", CompressedDynamicProps: StringList{"times"}},
+		3: {ID: 3, Type: "tag_tool", AccessoryDescription: "Also counts %kills%."},
+		4: {ID: 4, Type: "item", Description: "No properties."},
+	}
+
+	tests := []struct {
+		name string
+		item ItemInstance
+		lang string
+		want string
+
+		// undeclared properties, in order
+		undeclared []UndeclaredPropertyError
+	}{
+		{
+			name: "properties",
+			item: ItemInstance{Item: 1, Quantity: 3, DynamicProps: map[string]int64{"kills": 42}},
+			lang: "english",
+			want: "Killed 42 aliens.\nStack of 3.",
+		},
+		{
+			name: "translated",
+			item: ItemInstance{Item: 1, Quantity: 1, DynamicProps: map[string]int64{"kills": 7, "m_unQuantity": 5}},
+			lang: "german",
+			want: "7 Aliens getötet.\nStack of 5.",
+		},
+		{
+			name: "unset property",
+			item: ItemInstance{Item: 1, Quantity: 1},
+			lang: "english",
+			want: "Killed 0 aliens.\nStack of 1.",
+		},
+		{
+			name: "accessory",
+			item: ItemInstance{Item: 1, Quantity: 1, Tags: KeyValuePairs{{"sticker", "2"}}, DynamicProps: map[string]int64{"times": 2}},
+			lang: "english",
+			want: "Killed 0 aliens.\nStack of 1.\nSticker applied 2 times.",
+		},
+		{
+			// the accessory's template uses the tool's declarations, not
+			// the item's
+			name:       "undeclared accessory property",
+			item:       ItemInstance{Item: 1, Quantity: 1, Tags: KeyValuePairs{{"sticker", "3"}}},
+			lang:       "english",
+			want:       "Killed 0 aliens.\nStack of 1.\nAlso counts %kills%.",
+			undeclared: []UndeclaredPropertyError{{Item: 3, Field: "accessory_description", Property: "kills"}},
+		},
+		{
+			name: "no properties",
+			item: ItemInstance{Item: 4, Quantity: 1},
+			lang: "english",
+			want: "No properties.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderDescription(defs, &tt.item, tt.lang)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			var undeclared []UndeclaredPropertyError
+			if err != nil {
+				for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+					var perr *UndeclaredPropertyError
+					if !errors.As(e, &perr) {
+						t.Fatalf("unexpected error %v", e)
+					}
+
+					undeclared = append(undeclared, *perr)
+				}
+			}
+
+			if !reflect.DeepEqual(undeclared, tt.undeclared) {
+				t.Errorf("got undeclared properties %v, want %v", undeclared, tt.undeclared)
+			}
+		})
+	}
+
+	t.Run("unknown item", func(t *testing.T) {
+		got, err := RenderDescription(defs, &ItemInstance{Item: 99999, Quantity: 1}, "english")
+		if err == nil {
+			t.Errorf("got %q, want an error", got)
+		}
+	})
+}
+
+func TestUndeclaredProperties(t *testing.T) {
+	def := &ItemDef{
+		ID:                     1,
+		Description:            "%kills% kills",
+		DescriptionFrench:      "%morts% tués",
+		AfterDescription:       "%kills% and %streak%",
+		AccessoryDescription:   "%applied%",
+		CompressedDynamicProps: StringList{"kills"},
+	}
+
+	want := []UndeclaredPropertyError{
+		{Item: 1, Field: "accessory_description", Property: "applied"},
+		{Item: 1, Field: "after_description", Property: "streak"},
+		{Item: 1, Field: "description_french", Property: "morts"},
+	}
+
+	var got []UndeclaredPropertyError
+	for _, e := range undeclaredProperties(def) {
+		got = append(got, *e)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package steaminventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// Roller makes the random choices for GenerateItems. A Roller must not be
+// shared between goroutines.
+type Roller interface {
+	// Roll returns a uniformly distributed number in [0, n). id is the
+	// generator or tag_generator that the number is for, or 0 if the number
+	// isn't for an item definition.
+	Roll(id int32, n int64) int64
+}
+
+type randRoller struct {
+	r *rand.Rand
+}
+
+// NewRoller returns a Roller that always makes the same choices for the
+// same seed.
+func NewRoller(seed int64) Roller {
+	return randRoller{r: rand.New(rand.NewSource(seed))}
+}
+
+func (r randRoller) Roll(id int32, n int64) int64 {
+	return r.r.Int63n(n)
+}
+
+type Roll struct {
+	Item  int32 `json:"itemdefid"`
+	N     int64 `json:"n"`
+	Value int64 `json:"value"`
+}
+
+// RollRecorder remembers every choice made by another Roller.
+type RollRecorder struct {
+	Roller Roller
+	Rolls  []Roll
+}
+
+func (r *RollRecorder) Roll(id int32, n int64) int64 {
+	value := r.Roller.Roll(id, n)
+
+	r.Rolls = append(r.Rolls, Roll{
+		Item:  id,
+		N:     n,
+		Value: value,
+	})
+
+	return value
+}
+
+// RollReplayer repeats the choices recorded by a RollRecorder. If the
+// choices are requested in a different order than they were recorded,
+// which happens if the item schema changed, or a recorded value is out of
+// range, every roll from then on returns 0 and Err returns the first
+// problem. Callers must check Err after using the replayer.
+type RollReplayer struct {
+	Rolls []Roll
+	next  int
+	err   error
+}
+
+func (r *RollReplayer) Roll(id int32, n int64) int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	if r.next >= len(r.Rolls) {
+		r.err = fmt.Errorf("replay: ran out of recorded rolls after %d", len(r.Rolls))
+
+		return 0
+	}
+
+	roll := r.Rolls[r.next]
+	if roll.Item != id || roll.N != n {
+		r.err = fmt.Errorf("replay: roll %d was recorded for item %d (n=%d), but replayed for item %d (n=%d)", r.next, roll.Item, roll.N, id, n)
+
+		return 0
+	}
+
+	if roll.Value < 0 || roll.Value >= n {
+		r.err = fmt.Errorf("replay: roll %d has value %d, which is not in [0, %d)", r.next, roll.Value, n)
+
+		return 0
+	}
+
+	r.next++
+
+	return roll.Value
+}
+
+// Err returns the first problem the replayer found, if any.
+func (r *RollReplayer) Err() error {
+	return r.err
+}
+
+func LoadRolls(name string) ([]Roll, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var rolls []Roll
+	err = json.Unmarshal(b, &rolls)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return rolls, nil
+}
+
+func SaveRolls(name string, rolls []Roll) error {
+	b, err := json.MarshalIndent(rolls, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(name, append(b, '\n'), 0644)
+}
@@ -0,0 +1,119 @@
+package steaminventory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRollReplayer(t *testing.T) {
+	type call struct {
+		id int32
+		n  int64
+	}
+
+	recorded := []Roll{
+		{Item: 7000, N: 10, Value: 3},
+		{Item: 6001, N: 4, Value: 0},
+	}
+
+	tests := []struct {
+		name  string
+		rolls []Roll
+		calls []call
+		want  []int64
+		err   string
+	}{
+		{
+			name:  "same order",
+			rolls: recorded,
+			calls: []call{{7000, 10}, {6001, 4}},
+			want:  []int64{3, 0},
+		},
+		{
+			name:  "different item",
+			rolls: recorded,
+			calls: []call{{7001, 10}, {6001, 4}},
+			want:  []int64{0, 0},
+			err:   "roll 0 was recorded for item 7000",
+		},
+		{
+			name:  "different n",
+			rolls: recorded,
+			calls: []call{{7000, 10}, {6001, 5}},
+			want:  []int64{3, 0},
+			err:   "roll 1 was recorded for item 6001 (n=4)",
+		},
+		{
+			name:  "ran out",
+			rolls: recorded,
+			calls: []call{{7000, 10}, {6001, 4}, {7000, 10}},
+			want:  []int64{3, 0, 0},
+			err:   "ran out of recorded rolls after 2",
+		},
+		{
+			name:  "value out of range",
+			rolls: []Roll{{Item: 7000, N: 10, Value: 10}, {Item: 7000, N: 10, Value: 1}},
+			calls: []call{{7000, 10}, {7000, 10}},
+			want:  []int64{0, 0},
+			err:   "roll 0 has value 10",
+		},
+		{
+			name:  "negative value",
+			rolls: []Roll{{Item: 7000, N: 10, Value: -1}},
+			calls: []call{{7000, 10}},
+			want:  []int64{0},
+			err:   "roll 0 has value -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RollReplayer{Rolls: tt.rolls}
+
+			for i, c := range tt.calls {
+				if got := r.Roll(c.id, c.n); got != tt.want[i] {
+					t.Errorf("roll %d: got %d, want %d", i, got, tt.want[i])
+				}
+			}
+
+			err := r.Err()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	defs := testItemDefs(t)
+	items := TaggedBundleDefs{{Item: 7000, Quantity: 50}}
+
+	recorder := &RollRecorder{Roller: NewRoller(42)}
+	want, err := GenerateItems(defs, items, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer := &RollReplayer{Rolls: recorder.Rolls}
+	got, err := GenerateItems(defs, items, replayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = replayer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %v, recorded %v", got, want)
+	}
+}
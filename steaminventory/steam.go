@@ -0,0 +1,93 @@
+package steaminventory
+
+import (
+	"time"
+)
+
+// SteamTimeFormat is the timestamp format used by the Steam Inventory API.
+const SteamTimeFormat = "20060102T150405Z"
+
+// SteamItem is an item in the JSON format returned by the Steam Inventory
+// Web API methods GetInventory and AddItem.
+type SteamItem struct {
+	ItemID         uint64           `json:"itemid,string"`
+	ItemDefID      int32            `json:"itemdefid,string"`
+	Quantity       int32            `json:"quantity"`
+	OriginalItemID uint64           `json:"originalitemid,string"`
+	Acquired       string           `json:"acquired"`
+	State          string           `json:"state"`
+	Origin         string           `json:"origin"`
+	Tags           KeyValuePairs    `json:"tags,omitempty"`
+	DynamicProps   map[string]int64 `json:"dynamic_props,omitempty"`
+}
+
+func SteamItems(items []*ItemInstance) []SteamItem {
+	result := make([]SteamItem, len(items))
+	for i, item := range items {
+		result[i] = SteamItem{
+			ItemID:         item.ItemID,
+			ItemDefID:      item.Item,
+			Quantity:       item.Quantity,
+			OriginalItemID: item.OriginalItemID,
+			Acquired:       item.Acquired.UTC().Format(SteamTimeFormat),
+			State:          item.State,
+			Origin:         item.Origin,
+			Tags:           item.Tags,
+			DynamicProps:   item.DynamicProps,
+		}
+	}
+
+	return result
+}
+
+// SteamInventory grants items to a new inventory so they can be written in
+// the Steam format. The items are acquired at the given time so the output
+// only depends on the items.
+func SteamInventory(defs map[int32]*ItemDef, items TaggedBundleDefs, acquired time.Time, origin string) []SteamItem {
+	inv := NewInventory(&ItemIDAllocator{})
+	inv.Grant(defs, items, acquired, origin)
+
+	return SteamItems(inv.Items)
+}
+
+// Instance converts a stored item back to an item instance. The acquired
+// time was checked when the item was loaded.
+func (item SteamItem) Instance() *ItemInstance {
+	acquired, _ := time.Parse(SteamTimeFormat, item.Acquired)
+
+	instance := &ItemInstance{
+		ItemID:         item.ItemID,
+		OriginalItemID: item.OriginalItemID,
+		Item:           item.ItemDefID,
+		Quantity:       item.Quantity,
+		Acquired:       acquired,
+		State:          item.State,
+		Origin:         item.Origin,
+		Tags:           append(KeyValuePairs(nil), item.Tags...),
+	}
+
+	if len(item.DynamicProps) != 0 {
+		instance.DynamicProps = copyProps(item.DynamicProps)
+	}
+
+	return instance
+}
+
+// NewSteamItem returns an item in the Web API format that doesn't share any
+// tags or properties with item. Empty tags and properties are nil, as they
+// are after loading them from JSON.
+func NewSteamItem(item *ItemInstance) SteamItem {
+	stored := SteamItems([]*ItemInstance{item})[0]
+
+	stored.Tags = nil
+	if len(item.Tags) != 0 {
+		stored.Tags = append(KeyValuePairs(nil), item.Tags...)
+	}
+
+	stored.DynamicProps = nil
+	if len(item.DynamicProps) != 0 {
+		stored.DynamicProps = copyProps(item.DynamicProps)
+	}
+
+	return stored
+}
@@ -0,0 +1,72 @@
+package steaminventory
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSteamItems(t *testing.T) {
+	defs := testSchema(t, "crafting")
+	acquired := time.Date(2017, time.April, 20, 1, 2, 3, 0, time.FixedZone("PDT", -7*60*60))
+
+	inv := NewInventory(&ItemIDAllocator{})
+	inv.Grant(defs, TaggedBundleDefs{
+		{Item: 1, Quantity: 1, Tags: KeyValuePairs{{"color", "blue"}}},
+		{Item: 2, Quantity: 1},
+	}, acquired, OriginPlaytime)
+
+	b, err := json.Marshal(SteamItems(inv.Items))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ids are strings, times are in UTC, and items without tags have no
+	// tags field, like the real API
+	want := `[` +
+		`{"itemid":"1","itemdefid":"1","quantity":1,"originalitemid":"1","acquired":"20170420T080203Z","state":"","origin":"playtime","tags":"color:blue"},` +
+		`{"itemid":"2","itemdefid":"2","quantity":1,"originalitemid":"2","acquired":"20170420T080203Z","state":"","origin":"playtime"}` +
+		`]`
+	if string(b) != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+}
+
+func TestSteamInventory(t *testing.T) {
+	defs := testSchema(t, "crafting")
+
+	tests := []struct {
+		name  string
+		items TaggedBundleDefs
+		want  []SteamItem
+	}{
+		{
+			name:  "empty",
+			items: nil,
+			want:  []SteamItem{},
+		},
+		{
+			name:  "tagged",
+			items: TaggedBundleDefs{{Item: 1, Quantity: 1, Tags: KeyValuePairs{{"color", "blue"}}}, {Item: 2, Quantity: 1}},
+			want: []SteamItem{
+				{ItemID: 1, ItemDefID: 1, Quantity: 1, OriginalItemID: 1, Acquired: "20170420T000000Z", State: "", Origin: OriginExternal, Tags: KeyValuePairs{{"color", "blue"}}},
+				{ItemID: 2, ItemDefID: 2, Quantity: 1, OriginalItemID: 2, Acquired: "20170420T000000Z", State: "", Origin: OriginExternal},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SteamInventory(defs, tt.items, testTime, OriginExternal)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			// the same items must give the same output every time
+			if again := SteamInventory(defs, tt.items, testTime, OriginExternal); !reflect.DeepEqual(again, got) {
+				t.Errorf("second call gave %+v, want %+v", again, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+// Package steaminventory models the item definitions and player inventories
+// of the Steam Inventory service, and emulates the ISteamInventory client
+// interface of the Steamworks SDK on top of them.
+package steaminventory
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// EResult codes, like EResult in the Steamworks SDK
+const (
+	EResultOK            = 1
+	EResultFail          = 2
+	EResultInvalidParam  = 8
+	EResultFileNotFound  = 9
+	EResultAccessDenied  = 15
+	EResultPending       = 22
+	EResultLimitExceeded = 25
+	EResultExpired       = 27
+	EResultNoMatch       = 42
+)
+
+// EResultFor returns the EResult code for an error from an inventory
+// operation.
+func EResultFor(err error) int {
+	var notFound *ItemNotFoundError
+	var insufficient *InsufficientQuantityError
+	var tagTool *TagToolError
+	var extraction *ExtractionError
+	var token *TokenError
+	var quantity *InvalidQuantityError
+	switch {
+	case errors.As(err, &notFound):
+		return EResultFileNotFound
+	case errors.As(err, &insufficient):
+		return EResultLimitExceeded
+	case errors.Is(err, errClassNotUnlocked):
+		return EResultAccessDenied
+	case errors.Is(err, errNoMatchingRecipe), errors.As(err, &extraction), errors.As(err, &token):
+		return EResultNoMatch
+	case errors.As(err, &tagTool), errors.As(err, &quantity):
+		return EResultInvalidParam
+	}
+
+	return EResultFail
+}
+
+// SteamInventoryResult is a result handle, like SteamInventoryResult_t.
+type SteamInventoryResult int32
+
+const InvalidInventoryResult SteamInventoryResult = -1
+
+// InvalidItemInstanceID is k_SteamItemInstanceIDInvalid, which asks
+// TransferItemQuantity to split a stack.
+const InvalidItemInstanceID = math.MaxUint64
+
+// serialized results expire after this long, like Steam's
+const serializedResultLifetime = time.Hour
+
+// flags of SteamItemDetails, like ESteamItemFlags
+const (
+	ItemFlagNoTrade  = 1 << 0
+	ItemFlagRemoved  = 1 << 8
+	ItemFlagConsumed = 1 << 9
+)
+
+// SteamItemDetails is an item in a result, like SteamItemDetails_t.
+type SteamItemDetails struct {
+	ItemID     uint64 `json:"itemid,string"`
+	Definition int32  `json:"itemdefid"`
+	Quantity   uint16 `json:"quantity"`
+	Flags      uint16 `json:"flags"`
+}
+
+type inventoryResult struct {
+	Status    int                `json:"-"`
+	SteamID   uint64             `json:"steamid,string"`
+	Timestamp time.Time          `json:"timestamp"`
+	Items     []SteamItemDetails `json:"items"`
+}
+
+// Client emulates the ISteamInventory interface of the Steamworks SDK for
+// one player. Like Steam, every call that changes the inventory returns a
+// result handle whose status is pending until RunCallbacks is called.
+type Client struct {
+	defs    map[int32]*ItemDef
+	steamID uint64
+	player  *SimulatedPlayer
+	roller  Roller
+	now     func() time.Time
+
+	// signs serialized results, like Steam's signature
+	resultKey []byte
+
+	nextResult SteamInventoryResult
+	results    map[SteamInventoryResult]*inventoryResult
+	pending    []func()
+}
+
+// NewClient returns a client for the player with the given Steam ID.
+// Results serialized by a client can only be deserialized by clients with
+// the same resultKey, which stands in for the key Steam signs them with.
+func NewClient(defs map[int32]*ItemDef, steamID uint64, player *SimulatedPlayer, r Roller, resultKey []byte) *Client {
+	return &Client{
+		defs:      defs,
+		steamID:   steamID,
+		player:    player,
+		roller:    r,
+		now:       time.Now,
+		resultKey: append([]byte(nil), resultKey...),
+		results:   make(map[SteamInventoryResult]*inventoryResult),
+	}
+}
+
+// start creates a pending result that is completed by op when RunCallbacks
+// is called. op returns the items to report and how they were changed.
+func (c *Client) start(op func() ([]*ItemInstance, uint16, error)) (SteamInventoryResult, bool) {
+	handle := c.nextResult
+	c.nextResult++
+
+	result := &inventoryResult{
+		Status:  EResultPending,
+		SteamID: c.steamID,
+	}
+	c.results[handle] = result
+
+	c.pending = append(c.pending, func() {
+		items, flags, err := op()
+
+		result.Timestamp = c.now()
+		if err != nil {
+			result.Status = EResultFor(err)
+
+			return
+		}
+
+		result.Status = EResultOK
+		result.Items = itemDetails(items, flags)
+	})
+
+	return handle, true
+}
+
+// failed returns a result that fails with err when RunCallbacks is called,
+// for a call whose parameters were refused.
+func (c *Client) failed(err error) (SteamInventoryResult, bool) {
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		return nil, 0, err
+	})
+}
+
+// checkQuantity returns an error if quantity can't be moved to or from a
+// stack of itemID. A stack holds at most math.MaxInt32 items.
+func checkQuantity(itemID uint64, quantity uint32) error {
+	if quantity == 0 || quantity > math.MaxInt32 {
+		return &InvalidQuantityError{ItemID: itemID, Quantity: int64(quantity)}
+	}
+
+	return nil
+}
+
+func itemDetails(items []*ItemInstance, flags uint16) []SteamItemDetails {
+	details := make([]SteamItemDetails, len(items))
+	for i, item := range items {
+		quantity := item.Quantity
+		if quantity > math.MaxUint16 {
+			quantity = math.MaxUint16
+		}
+
+		details[i] = SteamItemDetails{
+			ItemID:     item.ItemID,
+			Definition: item.Item,
+			Quantity:   uint16(quantity),
+			Flags:      flags,
+		}
+
+		if item.Quantity == 0 {
+			details[i].Flags |= ItemFlagRemoved
+		}
+	}
+
+	return details
+}
+
+// RunCallbacks completes every pending result, like SteamAPI_RunCallbacks.
+func (c *Client) RunCallbacks() {
+	pending := c.pending
+	c.pending = nil
+
+	for _, op := range pending {
+		op()
+	}
+}
+
+// Play adds playtime for TriggerItemDrop. It is not part of
+// ISteamInventory; Steam measures playtime itself.
+func (c *Client) Play(playtime time.Duration) {
+	c.player.Play(playtime)
+}
+
+// GetResultStatus returns an EResult: pending, OK, or the reason the call
+// failed.
+func (c *Client) GetResultStatus(handle SteamInventoryResult) int {
+	result, ok := c.results[handle]
+	if !ok {
+		return EResultInvalidParam
+	}
+
+	return result.Status
+}
+
+func (c *Client) GetResultItems(handle SteamInventoryResult) ([]SteamItemDetails, bool) {
+	result, ok := c.results[handle]
+	if !ok || result.Status != EResultOK {
+		return nil, false
+	}
+
+	return append([]SteamItemDetails(nil), result.Items...), true
+}
+
+func (c *Client) GetResultTimestamp(handle SteamInventoryResult) time.Time {
+	result, ok := c.results[handle]
+	if !ok {
+		return time.Time{}
+	}
+
+	return result.Timestamp
+}
+
+func (c *Client) CheckResultSteamID(handle SteamInventoryResult, steamID uint64) bool {
+	result, ok := c.results[handle]
+
+	return ok && result.SteamID == steamID
+}
+
+func (c *Client) DestroyResult(handle SteamInventoryResult) {
+	delete(c.results, handle)
+}
+
+// SerializeResult encodes a completed result so that it can be sent to
+// another player, who can check it with DeserializeResult. The encoded
+// result starts with an HMAC-SHA256 of the rest.
+func (c *Client) SerializeResult(handle SteamInventoryResult) ([]byte, bool) {
+	result, ok := c.results[handle]
+	if !ok || result.Status != EResultOK {
+		return nil, false
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, false
+	}
+
+	return append(c.resultMAC(b), b...), true
+}
+
+// DeserializeResult creates a result from the output of SerializeResult.
+// It fails if buf was changed or was serialized by a client with a
+// different result key. The result is ready immediately; its status is
+// expired if it was serialized more than an hour ago.
+func (c *Client) DeserializeResult(buf []byte) (SteamInventoryResult, bool) {
+	if len(buf) < sha256.Size {
+		return InvalidInventoryResult, false
+	}
+
+	mac, b := buf[:sha256.Size], buf[sha256.Size:]
+	if !hmac.Equal(mac, c.resultMAC(b)) {
+		return InvalidInventoryResult, false
+	}
+
+	var result inventoryResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		return InvalidInventoryResult, false
+	}
+
+	result.Status = EResultOK
+	if c.now().Sub(result.Timestamp) > serializedResultLifetime {
+		result.Status = EResultExpired
+	}
+
+	handle := c.nextResult
+	c.nextResult++
+	c.results[handle] = &result
+
+	return handle, true
+}
+
+func (c *Client) resultMAC(b []byte) []byte {
+	mac := hmac.New(sha256.New, c.resultKey)
+	mac.Write(b)
+
+	return mac.Sum(nil)
+}
+
+func (c *Client) GetAllItems() (SteamInventoryResult, bool) {
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		return append([]*ItemInstance(nil), c.player.Inventory.Items...), 0, nil
+	})
+}
+
+// GenerateItems grants items directly, as a developer would in testing.
+func (c *Client) GenerateItems(itemDefs []int32, quantities []uint32) (SteamInventoryResult, bool) {
+	if len(itemDefs) == 0 || (quantities != nil && len(quantities) != len(itemDefs)) {
+		return InvalidInventoryResult, false
+	}
+
+	items := make(TaggedBundleDefs, len(itemDefs))
+	for i, id := range itemDefs {
+		def, ok := c.defs[id]
+		if !ok || def.Type == "tag_generator" {
+			return InvalidInventoryResult, false
+		}
+
+		items[i] = TaggedBundleDef{Item: id, Quantity: 1}
+		if quantities != nil {
+			if err := checkQuantity(0, quantities[i]); err != nil {
+				return c.failed(err)
+			}
+
+			items[i].Quantity = int64(quantities[i])
+		}
+	}
+
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		generated, err := GenerateItems(c.defs, items, c.roller)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return c.player.Inventory.Grant(c.defs, generated, c.now(), OriginExternal), 0, nil
+	})
+}
+
+// GrantPromoItems grants every promo item the player hasn't received yet.
+func (c *Client) GrantPromoItems() (SteamInventoryResult, bool) {
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		var promos []int32
+		for id, def := range c.defs {
+			if def.Promo != "" {
+				promos = append(promos, id)
+			}
+		}
+
+		sort.Slice(promos, func(i, j int) bool {
+			return promos[i] < promos[j]
+		})
+
+		var granted []*ItemInstance
+		for _, id := range promos {
+			items, err := c.grantPromo(id)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			granted = append(granted, items...)
+		}
+
+		return granted, 0, nil
+	})
+}
+
+func (c *Client) AddPromoItem(itemDef int32) (SteamInventoryResult, bool) {
+	def, ok := c.defs[itemDef]
+	if !ok || def.Promo == "" {
+		return InvalidInventoryResult, false
+	}
+
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		granted, err := c.grantPromo(itemDef)
+
+		return granted, 0, err
+	})
+}
+
+func (c *Client) grantPromo(id int32) ([]*ItemInstance, error) {
+	if c.player.ClaimedPromos[id] {
+		return nil, nil
+	}
+
+	items, err := GenerateItems(c.defs, TaggedBundleDefs{{Item: id, Quantity: 1}}, c.roller)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.player.ClaimedPromos == nil {
+		c.player.ClaimedPromos = make(map[int32]bool)
+	}
+	c.player.ClaimedPromos[id] = true
+
+	return c.player.Inventory.Grant(c.defs, items, c.now(), OriginPromo), nil
+}
+
+// TriggerItemDrop grants an item from a playtimegenerator if the player has
+// played long enough. The result is empty if nothing dropped.
+func (c *Client) TriggerItemDrop(dropListDefinition int32) (SteamInventoryResult, bool) {
+	def, ok := c.defs[dropListDefinition]
+	if !ok || def.Type != "playtimegenerator" {
+		return InvalidInventoryResult, false
+	}
+
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		dropped, err := c.player.TriggerItemDrop(c.defs, c.roller, dropListDefinition, c.now())
+
+		return dropped, 0, err
+	})
+}
+
+// ExchangeItems destroys the given materials to create one item. Like
+// Steam, exactly one item with a quantity of 1 can be generated. Strange
+// Devices are extracted from the item they are attached to, and tokens can
+// only be redeemed for items of classes the player has unlocked.
+func (c *Client) ExchangeItems(generate []int32, generateQuantity []uint32, destroy []uint64, destroyQuantity []uint32) (SteamInventoryResult, bool) {
+	if len(generate) != 1 || len(generateQuantity) != 1 || generateQuantity[0] != 1 {
+		return InvalidInventoryResult, false
+	}
+
+	if len(destroy) == 0 || len(destroy) != len(destroyQuantity) {
+		return InvalidInventoryResult, false
+	}
+
+	materials := make([]ExchangeMaterial, len(destroy))
+	for i := range destroy {
+		if err := checkQuantity(destroy[i], destroyQuantity[i]); err != nil {
+			return c.failed(err)
+		}
+
+		materials[i] = ExchangeMaterial{
+			ItemID:   destroy[i],
+			Quantity: int32(destroyQuantity[i]),
+		}
+	}
+
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		changed, err := c.player.Exchange(c.defs, materials, generate[0], c.roller, c.now())
+
+		return changed, 0, err
+	})
+}
+
+func (c *Client) ConsumeItem(itemConsume uint64, quantity uint32) (SteamInventoryResult, bool) {
+	if err := checkQuantity(itemConsume, quantity); err != nil {
+		return c.failed(err)
+	}
+
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		item := c.player.Inventory.Find(itemConsume)
+		if item == nil {
+			return nil, 0, &ItemNotFoundError{ItemID: itemConsume}
+		}
+
+		err := c.player.Inventory.Consume(itemConsume, int32(quantity))
+
+		return []*ItemInstance{item}, ItemFlagConsumed, err
+	})
+}
+
+// ApplyTagTool applies the tag tool itemTool to itemTarget, consuming one of
+// the tool. It is not part of ISteamInventory, which has no way to apply
+// tag tools; the result has the tool and the changed target.
+func (c *Client) ApplyTagTool(itemTool, itemTarget uint64) (SteamInventoryResult, bool) {
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		tool, target, err := c.player.Inventory.CheckTagTool(c.defs, itemTool, itemTarget)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		_, err = c.player.Inventory.ApplyTagTool(c.defs, itemTool, itemTarget, c.now())
+
+		return []*ItemInstance{tool, target}, 0, err
+	})
+}
+
+// TransferItemQuantity moves quantity between two stacks of the same item,
+// or splits it into a new stack if itemIDDest is InvalidItemInstanceID.
+func (c *Client) TransferItemQuantity(itemIDSource uint64, quantity uint32, itemIDDest uint64) (SteamInventoryResult, bool) {
+	if err := checkQuantity(itemIDSource, quantity); err != nil {
+		return c.failed(err)
+	}
+
+	if itemIDDest == InvalidItemInstanceID {
+		itemIDDest = 0
+	}
+
+	return c.start(func() ([]*ItemInstance, uint16, error) {
+		changed, err := c.player.Inventory.transferQuantity(itemIDSource, int32(quantity), itemIDDest)
+
+		return changed, 0, err
+	})
+}
@@ -0,0 +1,491 @@
+package steaminventory
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSteamID is the SteamID64 of the player in client tests.
+const testSteamID = 76561197960265729
+
+// testResultKey signs the serialized results of test clients.
+var testResultKey = []byte("test result key")
+
+// newTestClient returns a client for a new player whose clock is always
+// testTime.
+func newTestClient(defs map[int32]*ItemDef) *Client {
+	c := NewClient(defs, testSteamID, NewSimulatedPlayer(&ItemIDAllocator{}), NewRoller(1), testResultKey)
+	c.now = func() time.Time {
+		return testTime
+	}
+
+	return c
+}
+
+func TestClientResults(t *testing.T) {
+	defs := testItemDefs(t)
+	c := newTestClient(defs)
+
+	handle, ok := c.GenerateItems([]int32{3001, 3002}, []uint32{2, 1})
+	if !ok {
+		t.Fatal("GenerateItems returned an invalid handle")
+	}
+
+	if status := c.GetResultStatus(handle); status != EResultPending {
+		t.Fatalf("got status %d before RunCallbacks, want pending", status)
+	}
+
+	c.RunCallbacks()
+
+	if status := c.GetResultStatus(handle); status != EResultOK {
+		t.Fatalf("got status %d, want OK", status)
+	}
+
+	items, ok := c.GetResultItems(handle)
+	// 3001 doesn't stack, so each unit is its own instance
+	if !ok || len(items) != 3 || items[0].Definition != 3001 || items[1].Definition != 3001 || items[2].Definition != 3002 {
+		t.Fatalf("got items %+v, want 2 of 3001 and 1 of 3002", items)
+	}
+
+	if !c.CheckResultSteamID(handle, testSteamID) || c.CheckResultSteamID(handle, testSteamID+1) {
+		t.Error("CheckResultSteamID does not match the player")
+	}
+
+	Consume, _ := c.ConsumeItem(items[0].ItemID, 1)
+	tooMany, _ := c.ConsumeItem(items[2].ItemID, 2)
+	missing, _ := c.ConsumeItem(items[2].ItemID+100, 1)
+	c.RunCallbacks()
+
+	if consumed, _ := c.GetResultItems(Consume); len(consumed) != 1 || consumed[0].Quantity != 0 || consumed[0].Flags&ItemFlagConsumed == 0 {
+		t.Errorf("got consumed items %+v, want none left with the consumed flag", consumed)
+	}
+
+	if status := c.GetResultStatus(tooMany); status != EResultLimitExceeded {
+		t.Errorf("consuming too many: got status %d, want %d", status, EResultLimitExceeded)
+	}
+
+	if status := c.GetResultStatus(missing); status != EResultFileNotFound {
+		t.Errorf("consuming a missing item: got status %d, want %d", status, EResultFileNotFound)
+	}
+
+	c.DestroyResult(handle)
+	if status := c.GetResultStatus(handle); status != EResultInvalidParam {
+		t.Errorf("got status %d for a destroyed result, want %d", status, EResultInvalidParam)
+	}
+
+	if _, ok := c.GenerateItems([]int32{12345}, nil); ok {
+		t.Error("GenerateItems accepted an unknown item")
+	}
+}
+
+func TestClientSerializeResult(t *testing.T) {
+	defs := testItemDefs(t)
+	c := newTestClient(defs)
+
+	handle, _ := c.GetAllItems()
+	if _, ok := c.SerializeResult(handle); ok {
+		t.Error("serialized a pending result")
+	}
+
+	c.RunCallbacks()
+
+	buf, ok := c.SerializeResult(handle)
+	if !ok {
+		t.Fatal("could not serialize a completed result")
+	}
+
+	other := newTestClient(defs)
+	received, ok := other.DeserializeResult(buf)
+	if !ok || other.GetResultStatus(received) != EResultOK || !other.CheckResultSteamID(received, testSteamID) {
+		t.Errorf("got status %d for a new serialized result, want OK from the first player", other.GetResultStatus(received))
+	}
+
+	other.now = func() time.Time {
+		return testTime.Add(serializedResultLifetime + time.Second)
+	}
+
+	received, ok = other.DeserializeResult(buf)
+	if !ok || other.GetResultStatus(received) != EResultExpired {
+		t.Errorf("got status %d for an old serialized result, want expired", other.GetResultStatus(received))
+	}
+
+	if _, ok := other.DeserializeResult([]byte("not a result")); ok {
+		t.Error("deserialized garbage")
+	}
+}
+
+func TestClientApplyTagTool(t *testing.T) {
+	tests := []struct {
+		name   string
+		tool   int32
+		status int
+	}{
+		{name: "device", tool: 10, status: EResultOK},
+		{name: "not a tag tool", tool: 30, status: EResultInvalidParam},
+		{name: "tag not allowed", tool: 40, status: EResultInvalidParam},
+	}
+
+	defs := testSchema(t, "tagtools")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(defs)
+			granted := c.player.Inventory.Grant(defs, TaggedBundleDefs{{Item: tt.tool, Quantity: 1}, {Item: 1, Quantity: 1}}, testTime, OriginExternal)
+
+			handle, ok := c.ApplyTagTool(granted[0].ItemID, granted[1].ItemID)
+			if !ok {
+				t.Fatal("ApplyTagTool returned an invalid handle")
+			}
+
+			c.RunCallbacks()
+
+			if status := c.GetResultStatus(handle); status != tt.status {
+				t.Fatalf("got status %d, want %d", status, tt.status)
+			}
+
+			items, _ := c.GetResultItems(handle)
+			if tt.status != EResultOK {
+				if len(items) != 0 || granted[0].Quantity != 1 {
+					t.Errorf("a refused tool changed the inventory: %+v", items)
+				}
+
+				return
+			}
+
+			if len(items) != 2 || items[0].Flags&ItemFlagRemoved == 0 || items[1].ItemID != granted[1].ItemID {
+				t.Errorf("got %+v, want the removed tool and the target", items)
+			}
+
+			if len(granted[1].Tags) != 1 {
+				t.Errorf("target has tags %v after the tool was applied", granted[1].Tags)
+			}
+		})
+	}
+}
+
+func TestClientQuantities(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item", AutoStack: true},
+		2: {ID: 2, Type: "item", Exchange: ExchangeRecipes{{{Item: 1, Quantity: 1}}}},
+	}
+
+	tests := []struct {
+		name   string
+		call   func(c *Client, itemID uint64) (SteamInventoryResult, bool)
+		status int
+
+		// quantity of the stack of 5 of item 1 after the call
+		want int32
+	}{
+		{
+			name: "consume",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.ConsumeItem(itemID, 2)
+			},
+			status: EResultOK,
+			want:   3,
+		},
+		{
+			name: "consume none",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.ConsumeItem(itemID, 0)
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+		{
+			name: "consume more than a stack",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.ConsumeItem(itemID, math.MaxInt32+1)
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+		{
+			name: "transfer none",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.TransferItemQuantity(itemID, 0, InvalidItemInstanceID)
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+		{
+			name: "transfer more than a stack",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.TransferItemQuantity(itemID, math.MaxUint32, InvalidItemInstanceID)
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+		{
+			name: "split",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.TransferItemQuantity(itemID, 1, InvalidItemInstanceID)
+			},
+			status: EResultOK,
+			want:   4,
+		},
+		{
+			name: "generate none",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.GenerateItems([]int32{1}, []uint32{0})
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+		{
+			name: "generate more than a stack",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.GenerateItems([]int32{1}, []uint32{math.MaxInt32 + 1})
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+		{
+			name: "exchange more than a stack",
+			call: func(c *Client, itemID uint64) (SteamInventoryResult, bool) {
+				return c.ExchangeItems([]int32{2}, []uint32{1}, []uint64{itemID}, []uint32{math.MaxUint32})
+			},
+			status: EResultInvalidParam,
+			want:   5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(defs)
+			stack := c.player.Inventory.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: 5}}, testTime, OriginExternal)[0]
+
+			handle, ok := tt.call(c, stack.ItemID)
+			if !ok {
+				t.Fatal("got an invalid handle")
+			}
+
+			if status := c.GetResultStatus(handle); status != EResultPending {
+				t.Errorf("got status %d before RunCallbacks, want pending", status)
+			}
+
+			c.RunCallbacks()
+
+			if status := c.GetResultStatus(handle); status != tt.status {
+				t.Errorf("got status %d, want %d", status, tt.status)
+			}
+
+			if stack.Quantity != tt.want {
+				t.Errorf("stack has %d, want %d", stack.Quantity, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientResultStatus(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item"},
+	}
+
+	tests := []struct {
+		name string
+
+		// call starts a request for a player who has one of item 1
+		call    func(c *Client, itemID uint64) SteamInventoryResult
+		before  int
+		after   int
+		destroy bool
+		items   int
+	}{
+		{
+			name: "unknown handle",
+			call: func(c *Client, itemID uint64) SteamInventoryResult {
+				return 42
+			},
+			before: EResultInvalidParam,
+			after:  EResultInvalidParam,
+		},
+		{
+			name: "completed",
+			call: func(c *Client, itemID uint64) SteamInventoryResult {
+				handle, _ := c.GetAllItems()
+
+				return handle
+			},
+			before: EResultPending,
+			after:  EResultOK,
+			items:  1,
+		},
+		{
+			name: "failed",
+			call: func(c *Client, itemID uint64) SteamInventoryResult {
+				handle, _ := c.ConsumeItem(itemID+1, 1)
+
+				return handle
+			},
+			before: EResultPending,
+			after:  EResultFileNotFound,
+		},
+		{
+			name: "destroyed",
+			call: func(c *Client, itemID uint64) SteamInventoryResult {
+				handle, _ := c.GetAllItems()
+
+				return handle
+			},
+			before:  EResultPending,
+			after:   EResultInvalidParam,
+			destroy: true,
+		},
+		{
+			name: "invalid call",
+			call: func(c *Client, itemID uint64) SteamInventoryResult {
+				handle, _ := c.TriggerItemDrop(1)
+
+				return handle
+			},
+			before: EResultInvalidParam,
+			after:  EResultInvalidParam,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(defs)
+			item := c.player.Inventory.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: 1}}, testTime, OriginExternal)[0]
+
+			handle := tt.call(c, item.ItemID)
+
+			if status := c.GetResultStatus(handle); status != tt.before {
+				t.Errorf("got status %d before RunCallbacks, want %d", status, tt.before)
+			}
+
+			if _, ok := c.GetResultItems(handle); ok {
+				t.Error("got items before RunCallbacks")
+			}
+
+			c.RunCallbacks()
+
+			if tt.destroy {
+				c.DestroyResult(handle)
+			}
+
+			if status := c.GetResultStatus(handle); status != tt.after {
+				t.Errorf("got status %d after RunCallbacks, want %d", status, tt.after)
+			}
+
+			items, ok := c.GetResultItems(handle)
+			if ok != (tt.after == EResultOK) || len(items) != tt.items {
+				t.Errorf("got items %+v (%v), want %d items", items, ok, tt.items)
+			}
+
+			if tt.after == EResultOK && !c.GetResultTimestamp(handle).Equal(testTime) {
+				t.Errorf("got timestamp %v, want %v", c.GetResultTimestamp(handle), testTime)
+			}
+		})
+	}
+}
+
+func TestClientDeserializeResult(t *testing.T) {
+	defs := map[int32]*ItemDef{
+		1: {ID: 1, Type: "item"},
+	}
+
+	tests := []struct {
+		name string
+		key  []byte
+
+		// change alters the serialized result before it is deserialized
+		change func(buf []byte) []byte
+
+		// how long after the result the other player deserializes it
+		after time.Duration
+
+		ok     bool
+		status int
+	}{
+		{name: "same key", key: testResultKey, ok: true, status: EResultOK},
+		{name: "expired", key: testResultKey, after: 2 * time.Hour, ok: true, status: EResultExpired},
+		{name: "other key", key: []byte("other key")},
+		{
+			name: "changed item",
+			key:  testResultKey,
+			change: func(buf []byte) []byte {
+				return bytes.Replace(buf, []byte(`"itemdefid":1`), []byte(`"itemdefid":2`), 1)
+			},
+		},
+		{
+			name: "changed MAC",
+			key:  testResultKey,
+			change: func(buf []byte) []byte {
+				buf[0] ^= 1
+
+				return buf
+			},
+		},
+		{
+			name: "truncated",
+			key:  testResultKey,
+			change: func(buf []byte) []byte {
+				return buf[:10]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(defs)
+			c.player.Inventory.Grant(defs, TaggedBundleDefs{{Item: 1, Quantity: 1}}, testTime, OriginExternal)
+
+			handle, _ := c.GetAllItems()
+			if _, ok := c.SerializeResult(handle); ok {
+				t.Error("serialized a pending result")
+			}
+
+			c.RunCallbacks()
+
+			buf, ok := c.SerializeResult(handle)
+			if !ok {
+				t.Fatal("could not serialize the result")
+			}
+
+			if tt.change != nil {
+				buf = tt.change(buf)
+			}
+
+			other := NewClient(defs, testSteamID+1, NewSimulatedPlayer(&ItemIDAllocator{}), NewRoller(1), tt.key)
+			other.now = func() time.Time {
+				return testTime.Add(tt.after)
+			}
+
+			received, ok := other.DeserializeResult(buf)
+			if ok != tt.ok {
+				t.Fatalf("DeserializeResult returned %v, want %v", ok, tt.ok)
+			}
+
+			if !ok {
+				if received != InvalidInventoryResult {
+					t.Errorf("got handle %d for a refused result", received)
+				}
+
+				return
+			}
+
+			if status := other.GetResultStatus(received); status != tt.status {
+				t.Errorf("got status %d, want %d", status, tt.status)
+			}
+
+			if !other.CheckResultSteamID(received, testSteamID) || other.CheckResultSteamID(received, testSteamID+1) {
+				t.Error("the result doesn't belong to the player who serialized it")
+			}
+
+			if tt.status != EResultOK {
+				return
+			}
+
+			want, _ := c.GetResultItems(handle)
+			if got, _ := other.GetResultItems(received); !reflect.DeepEqual(got, want) {
+				t.Errorf("got items %+v, want %+v", got, want)
+			}
+		})
+	}
+}
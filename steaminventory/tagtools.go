@@ -0,0 +1,150 @@
+package steaminventory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxAttachedDevices is the number of accessories an item can have. Strange
+// Devices can only be attached to items with fewer than this many other
+// devices attached.
+const maxAttachedDevices = 4
+
+// reasons a tag tool can't be applied
+var (
+	errNotTagTool      = errors.New("tool is not a tag_tool")
+	errSameItem        = errors.New("a tag tool cannot be applied to itself")
+	errTagNotAllowed   = errors.New("target does not allow this tag from tools")
+	errAlreadyAttached = errors.New("target already has this tag")
+	errTooManyDevices  = fmt.Errorf("target already has %d devices attached", maxAttachedDevices)
+)
+
+type TagToolError struct {
+	ToolID   uint64
+	TargetID uint64
+	Tag      KeyValuePair
+	Err      error
+}
+
+func (e *TagToolError) Error() string {
+	if e.Tag.Key == "" {
+		return fmt.Sprintf("cannot apply item %d to item %d: %v", e.ToolID, e.TargetID, e.Err)
+	}
+
+	return fmt.Sprintf("cannot apply %s:%s from item %d to item %d: %v", e.Tag.Key, e.Tag.Value, e.ToolID, e.TargetID, e.Err)
+}
+
+func (e *TagToolError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyTagTool adds the tags of a tag tool to an item in the inventory and
+// consumes one of the tool. The target must list every tag in
+// allowed_tags_from_tools, and a tag for its accessory tag can only be
+// added while fewer than maxAttachedDevices devices are attached. What
+// happened is appended to the inventory's event log and returned.
+func (inv *Inventory) ApplyTagTool(defs map[int32]*ItemDef, toolItemID, targetItemID uint64, now time.Time) ([]InventoryEvent, error) {
+	tool, target, err := inv.CheckTagTool(defs, toolItemID, targetItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []InventoryEvent{
+		{
+			Time:     now,
+			Action:   EventConsumed,
+			ItemID:   tool.ItemID,
+			Item:     tool.Item,
+			Quantity: 1,
+			Tags:     append(KeyValuePairs(nil), tool.Tags...),
+			Props:    copyProps(tool.DynamicProps),
+		},
+	}
+
+	if err = inv.Consume(toolItemID, 1); err != nil {
+		return nil, err
+	}
+
+	target.Tags = append(target.Tags, defs[tool.Item].Tags...)
+	target.initCounters(defs)
+
+	events = append(events, InventoryEvent{
+		Time:     now,
+		Action:   EventToolApplied,
+		ItemID:   target.ItemID,
+		Item:     tool.Item,
+		Quantity: 1,
+		Tags:     append(KeyValuePairs(nil), target.Tags...),
+		Props:    copyProps(target.DynamicProps),
+	})
+
+	inv.Events = append(inv.Events, events...)
+
+	return events, nil
+}
+
+// CheckTagTool returns the tool and target instances if ApplyTagTool would
+// succeed, without changing anything.
+func (inv *Inventory) CheckTagTool(defs map[int32]*ItemDef, toolItemID, targetItemID uint64) (tool, target *ItemInstance, err error) {
+	tool = inv.Find(toolItemID)
+	if tool == nil {
+		return nil, nil, &ItemNotFoundError{ItemID: toolItemID}
+	}
+
+	target = inv.Find(targetItemID)
+	if target == nil {
+		return nil, nil, &ItemNotFoundError{ItemID: targetItemID}
+	}
+
+	fail := func(tag KeyValuePair, err error) (*ItemInstance, *ItemInstance, error) {
+		return nil, nil, &TagToolError{
+			ToolID:   toolItemID,
+			TargetID: targetItemID,
+			Tag:      tag,
+			Err:      err,
+		}
+	}
+
+	toolDef := defs[tool.Item]
+	if toolDef.Type != "tag_tool" {
+		return fail(KeyValuePair{}, errNotTagTool)
+	}
+
+	if tool == target {
+		return fail(KeyValuePair{}, errSameItem)
+	}
+
+	targetDef := defs[target.Item]
+	devices := len(attachedTools(defs, targetDef, target.Tags))
+
+	for _, tag := range toolDef.Tags {
+		if !hasTag(targetDef.AllowedTagsFromTools, tag) {
+			return fail(tag, errTagNotAllowed)
+		}
+
+		if hasTag(targetDef.Tags, tag) || hasTag(target.Tags, tag) {
+			return fail(tag, errAlreadyAttached)
+		}
+
+		if tag.Key == targetDef.AccessoryTag {
+			if devices >= maxAttachedDevices {
+				return fail(tag, errTooManyDevices)
+			}
+
+			devices++
+		}
+	}
+
+	return tool, target, nil
+}
+
+func hasTag(tags KeyValuePairs, tag KeyValuePair) bool {
+	for _, kv := range tags {
+		if kv == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package steaminventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyTagTool(t *testing.T) {
+	tests := []struct {
+		name       string
+		tool       int32
+		target     int32
+		targetTags KeyValuePairs
+		sameItem   bool
+		missing    string
+		err        error
+		wantTags   KeyValuePairs
+	}{
+		{name: "device", tool: 10, target: 1, wantTags: KeyValuePairs{{"strange", "10"}}},
+		{name: "second device", tool: 11, target: 1, targetTags: KeyValuePairs{{"strange", "10"}}, wantTags: KeyValuePairs{{"strange", "10"}, {"strange", "11"}}},
+		{name: "paint on full item", tool: 20, target: 1, targetTags: KeyValuePairs{{"strange", "11"}, {"strange", "12"}, {"strange", "13"}, {"strange", "14"}}, wantTags: KeyValuePairs{{"strange", "11"}, {"strange", "12"}, {"strange", "13"}, {"strange", "14"}, {"paint", "red"}}},
+		{name: "missing tool", tool: 10, target: 1, missing: "tool", err: &ItemNotFoundError{}},
+		{name: "missing target", tool: 10, target: 1, missing: "target", err: &ItemNotFoundError{}},
+		{name: "not a tag tool", tool: 30, target: 1, err: errNotTagTool},
+		{name: "same item", tool: 10, target: 10, sameItem: true, err: errSameItem},
+		{name: "tag not allowed", tool: 40, target: 1, err: errTagNotAllowed},
+		{name: "already attached to instance", tool: 10, target: 1, targetTags: KeyValuePairs{{"strange", "10"}}, err: errAlreadyAttached},
+		{name: "already attached to definition", tool: 10, target: 2, err: errAlreadyAttached},
+		{name: "too many devices", tool: 10, target: 1, targetTags: KeyValuePairs{{"strange", "11"}, {"strange", "12"}, {"strange", "13"}, {"strange", "14"}}, err: errTooManyDevices},
+	}
+
+	defs := testSchema(t, "tagtools")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory(&ItemIDAllocator{})
+			tool := inv.Grant(defs, TaggedBundleDefs{{Item: tt.tool, Quantity: 1}}, testTime, OriginExternal)[0]
+			target := tool
+			if !tt.sameItem {
+				target = inv.Grant(defs, TaggedBundleDefs{{Item: tt.target, Quantity: 1, Tags: tt.targetTags}}, testTime, OriginExternal)[0]
+			}
+
+			toolID, targetID := tool.ItemID, target.ItemID
+			switch tt.missing {
+			case "tool":
+				toolID = 999
+			case "target":
+				targetID = 999
+			}
+
+			before := append(KeyValuePairs(nil), target.Tags...)
+
+			events, err := inv.ApplyTagTool(defs, toolID, targetID, testTime)
+
+			if tt.err != nil {
+				var notFound *ItemNotFoundError
+				var tagTool *TagToolError
+				if _, ok := tt.err.(*ItemNotFoundError); ok {
+					if !errors.As(err, &notFound) || notFound.ItemID != 999 {
+						t.Fatalf("got error %v, want item 999 not found", err)
+					}
+				} else if !errors.Is(err, tt.err) || !errors.As(err, &tagTool) {
+					t.Fatalf("got error %v, want a TagToolError for %v", err, tt.err)
+				}
+
+				if tool.Quantity != 1 || !reflect.DeepEqual(target.Tags, before) || len(inv.Events) != 0 {
+					t.Errorf("a refused tool changed the inventory: tool quantity %d, target tags %v, %d events", tool.Quantity, target.Tags, len(inv.Events))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tool.Quantity != 0 {
+				t.Errorf("tool quantity is %d after it was applied", tool.Quantity)
+			}
+
+			if !reflect.DeepEqual(target.Tags, tt.wantTags) {
+				t.Errorf("got tags %v, want %v", target.Tags, tt.wantTags)
+			}
+
+			for _, device := range attachedTools(defs, defs[target.Item], target.Tags) {
+				for _, counter := range device.CompressedDynamicProps {
+					if _, ok := target.DynamicProps[counter]; !ok {
+						t.Errorf("counter %s of an attached device is not set", counter)
+					}
+				}
+			}
+
+			wantEvents := []InventoryEvent{
+				{Time: testTime, Action: EventConsumed, ItemID: tool.ItemID, Item: tt.tool, Quantity: 1},
+				{Time: testTime, Action: EventToolApplied, ItemID: target.ItemID, Item: tt.tool, Quantity: 1, Tags: tt.wantTags, Props: copyProps(target.DynamicProps)},
+			}
+
+			if !reflect.DeepEqual(events, wantEvents) || !reflect.DeepEqual(inv.Events, wantEvents) {
+				t.Errorf("got events %+v, logged %+v, want %+v", events, inv.Events, wantEvents)
+			}
+		})
+	}
+}
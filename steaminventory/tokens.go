@@ -0,0 +1,193 @@
+package steaminventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// classRestrictionTag is the tag key that limits an item to a marine class.
+const classRestrictionTag = "class_restriction"
+
+// reasons a token can't be redeemed
+var (
+	errNoTokenRecipe    = errors.New("target cannot be exchanged for the token")
+	errClassNotUnlocked = errors.New("player has not unlocked the class the target is restricted to")
+)
+
+type TokenError struct {
+	TokenID uint64
+	Target  int32
+	Err     error
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("cannot exchange item %d for item %d: %v", e.TokenID, e.Target, e.Err)
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// tokenTargets returns the items that have an exchange recipe taking just
+// one of token, in itemdefid order.
+func tokenTargets(defs map[int32]*ItemDef, token int32) []int32 {
+	var targets []int32
+	for id, def := range defs {
+		if hasTokenRecipe(def, token) {
+			targets = append(targets, id)
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i] < targets[j]
+	})
+
+	return targets
+}
+
+// isToken returns true if item is a token like the Strange Item Token,
+// which can be exchanged on its own for any one of several items. An item
+// that is the only input of just one recipe is exchanged like any other
+// material, without checking class restrictions.
+func isToken(defs map[int32]*ItemDef, item int32) bool {
+	return len(tokenTargets(defs, item)) > 1
+}
+
+func hasTokenRecipe(def *ItemDef, token int32) bool {
+	for _, recipe := range def.Exchange {
+		if len(recipe) == 1 && recipe[0].Item == token && recipe[0].Quantity == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canAccess returns true if an item has no class restriction or is
+// restricted to one of classes.
+func canAccess(def *ItemDef, classes []string) bool {
+	restricted := false
+	for _, kv := range def.Tags {
+		if kv.Key != classRestrictionTag {
+			continue
+		}
+
+		restricted = true
+		for _, class := range classes {
+			if kv.Value == class {
+				return true
+			}
+		}
+	}
+
+	return !restricted
+}
+
+// redeemToken exchanges one of the token with the given item ID for the
+// target item, as the Strange Item Token does. The target is expanded with
+// GenerateItems and created without any Strange Devices. The player must
+// have unlocked one of the classes the target is restricted to.
+func (inv *Inventory) redeemToken(defs map[int32]*ItemDef, tokenItemID uint64, target int32, classes []string, r Roller, now time.Time) ([]InventoryEvent, error) {
+	token := inv.Find(tokenItemID)
+	if token == nil {
+		return nil, &ItemNotFoundError{ItemID: tokenItemID}
+	}
+
+	fail := func(err error) error {
+		return &TokenError{
+			TokenID: tokenItemID,
+			Target:  target,
+			Err:     err,
+		}
+	}
+
+	targetDef, ok := defs[target]
+	if !ok || !hasTokenRecipe(targetDef, token.Item) {
+		return nil, fail(errNoTokenRecipe)
+	}
+
+	if !canAccess(targetDef, classes) {
+		return nil, fail(errClassNotUnlocked)
+	}
+
+	generated, err := GenerateItems(defs, TaggedBundleDefs{{Item: target, Quantity: 1}}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []InventoryEvent{
+		{
+			Time:     now,
+			Action:   EventConsumed,
+			ItemID:   token.ItemID,
+			Item:     token.Item,
+			Quantity: 1,
+		},
+	}
+
+	if err := inv.Consume(tokenItemID, 1); err != nil {
+		return nil, err
+	}
+
+	for _, item := range inv.Grant(defs, generated, now, OriginExchange) {
+		events = append(events, InventoryEvent{
+			Time:     now,
+			Action:   EventCreated,
+			ItemID:   item.ItemID,
+			Item:     item.Item,
+			Quantity: item.Quantity,
+			Tags:     append(KeyValuePairs(nil), item.Tags...),
+		})
+	}
+
+	inv.Events = append(inv.Events, events...)
+
+	return events, nil
+}
+
+// RedeemTokens exchanges every token the player has for a random item the
+// player can access. Tokens that can't be used on anything are kept. The
+// tokens that were used and the items they were exchanged for are returned.
+func (p *SimulatedPlayer) RedeemTokens(defs map[int32]*ItemDef, r Roller, token int32, now time.Time) ([]*ItemInstance, error) {
+	var targets []int32
+	for _, id := range tokenTargets(defs, token) {
+		if canAccess(defs[id], p.Classes) {
+			targets = append(targets, id)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	var changed []*ItemInstance
+	for {
+		var tokenItem *ItemInstance
+		for _, item := range p.Inventory.Items {
+			if item.Item == token {
+				tokenItem = item
+
+				break
+			}
+		}
+
+		if tokenItem == nil {
+			return changed, nil
+		}
+
+		target := targets[r.Roll(token, int64(len(targets)))]
+		events, err := p.Inventory.redeemToken(defs, tokenItem.ItemID, target, p.Classes, r, now)
+		if err != nil {
+			return nil, err
+		}
+
+		changed = append(changed, tokenItem)
+		for _, event := range events {
+			if event.Action == EventCreated {
+				changed = append(changed, p.Inventory.Find(event.ItemID))
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package steaminventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExchangeRedeemsTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   int32
+		target  int32
+		classes []string
+		created int32
+		err     error
+	}{
+		{name: "unlocked class", token: 70, target: 71, classes: []string{"officer", "medic"}, created: 71},
+		{name: "no class restriction", token: 70, target: 72, created: 72},
+		{name: "generator", token: 70, target: 74, created: 72},
+		{name: "class not unlocked", token: 70, target: 71, classes: []string{"officer"}, err: errClassNotUnlocked},
+		{name: "no token recipe", token: 70, target: 73, classes: []string{"medic"}, err: errNoMatchingRecipe},
+		{name: "not a token", token: 76, target: 75, classes: []string{"officer"}, created: 75},
+	}
+
+	defs := testSchema(t, "tokens")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := NewSimulatedPlayer(&ItemIDAllocator{})
+			player.Classes = tt.classes
+			token := player.Inventory.Grant(defs, TaggedBundleDefs{{Item: tt.token, Quantity: 1}}, testTime, OriginPromo)[0]
+
+			changed, err := player.Exchange(defs, []ExchangeMaterial{{ItemID: token.ItemID, Quantity: 1}}, tt.target, NewRoller(1), testTime)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+
+				if len(player.Inventory.Items) != 1 || token.Quantity != 1 {
+					t.Errorf("a refused exchange changed the inventory")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(changed) != 2 || changed[0].Item != tt.created || changed[0].Origin != OriginExchange || changed[1] != token || token.Quantity != 0 {
+				t.Errorf("got %v, want item %d followed by the used token", changed, tt.created)
+			}
+		})
+	}
+}
+
+func TestRedeemToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  int32
+		classes []string
+		created int32
+		err     error
+	}{
+		{name: "unlocked class", target: 71, classes: []string{"officer", "medic"}, created: 71},
+		{name: "no class restriction", target: 72, created: 72},
+		{name: "generator", target: 74, created: 72},
+		{name: "class not unlocked", target: 71, classes: []string{"officer"}, err: errClassNotUnlocked},
+		{name: "no token recipe", target: 73, classes: []string{"medic"}, err: errNoTokenRecipe},
+		{name: "unknown target", target: 99, err: errNoTokenRecipe},
+	}
+
+	defs := testSchema(t, "tokens")
+	now := testTime
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := NewInventory(&ItemIDAllocator{})
+			token := inv.Grant(defs, TaggedBundleDefs{{Item: 70, Quantity: 1}}, now, OriginPromo)[0]
+
+			events, err := inv.redeemToken(defs, token.ItemID, tt.target, tt.classes, NewRoller(1), now)
+			if tt.err != nil {
+				var tokenErr *TokenError
+				if !errors.Is(err, tt.err) || !errors.As(err, &tokenErr) {
+					t.Fatalf("got error %v, want a TokenError for %v", err, tt.err)
+				}
+
+				if len(inv.Items) != 1 || token.Quantity != 1 || len(inv.Events) != 0 {
+					t.Errorf("a refused exchange changed the inventory")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(inv.Items) != 1 || inv.Items[0].Item != tt.created || inv.Items[0].Origin != OriginExchange {
+				t.Errorf("inventory holds %+v, want only item %d", inv.Items, tt.created)
+			}
+
+			if len(events) != 2 || events[0].Action != EventConsumed || events[0].ItemID != token.ItemID || events[1].Action != EventCreated || events[1].Item != tt.created {
+				t.Errorf("got events %+v", events)
+			}
+		})
+	}
+}
+
+func TestTokenTargets(t *testing.T) {
+	defs := testSchema(t, "tokens")
+
+	if got, want := tokenTargets(defs, 70), []int32{71, 72, 74}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := tokenTargets(defs, 73); len(got) != 0 {
+		t.Errorf("got %v for an item that isn't a token", got)
+	}
+
+	if !isToken(defs, 70) || isToken(defs, 73) || isToken(defs, 76) {
+		t.Errorf("only item 70 should be a token")
+	}
+}
+
+func TestRedeemTokens(t *testing.T) {
+	defs := testSchema(t, "tokens")
+
+	tests := []struct {
+		name    string
+		classes []string
+		tokens  int64
+		want    int
+	}{
+		{name: "every token", classes: []string{"medic"}, tokens: 3, want: 3},
+		{name: "unrestricted targets", tokens: 2, want: 2},
+		{name: "no tokens", classes: []string{"medic"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := NewSimulatedPlayer(&ItemIDAllocator{})
+			player.Classes = tt.classes
+			if tt.tokens != 0 {
+				player.Inventory.Grant(defs, TaggedBundleDefs{{Item: 70, Quantity: tt.tokens}}, testTime, OriginPromo)
+			}
+
+			changed, err := player.RedeemTokens(defs, NewRoller(1), 70, testTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// each token and the item it was exchanged for
+			if len(changed) != 2*tt.want {
+				t.Errorf("%d items changed, want %d", len(changed), 2*tt.want)
+			}
+
+			if len(player.Inventory.Items) != tt.want {
+				t.Errorf("inventory has %d items, want %d", len(player.Inventory.Items), tt.want)
+			}
+
+			for _, item := range player.Inventory.Items {
+				if item.Item == 70 || !canAccess(defs[item.Item], tt.classes) {
+					t.Errorf("player has item %d after redeeming their tokens", item.Item)
+				}
+			}
+		})
+	}
+}
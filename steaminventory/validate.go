@@ -0,0 +1,218 @@
+package steaminventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type ValidationError struct {
+	File string
+	ID   int32
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: item %d: %s", e.File, e.ID, e.Msg)
+}
+
+// validateItemDefs checks that every reference between item definitions
+// points at an item that exists and has a type that makes sense in that
+// position. All problems are returned at once (joined with errors.Join).
+func validateItemDefs(defs map[int32]*ItemDef) error {
+	ids := make([]int32, 0, len(defs))
+	for id := range defs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	// tags that can be applied by at least one tag tool
+	toolTags := make(map[KeyValuePair]bool)
+	for _, def := range defs {
+		if def.Type == "tag_tool" {
+			for _, kv := range def.Tags {
+				toolTags[kv] = true
+			}
+		}
+	}
+
+	// tags that an item in an inventory can have
+	itemTags := make(map[KeyValuePair]bool)
+	for _, def := range defs {
+		for _, kv := range def.Tags {
+			itemTags[kv] = true
+		}
+
+		if def.Type == "tag_generator" {
+			for _, option := range def.TagGeneratorValues {
+				itemTags[KeyValuePair{
+					Key:   def.TagGeneratorName,
+					Value: option.Value,
+				}] = true
+			}
+		}
+	}
+
+	var errs []error
+	for _, id := range ids {
+		errs = append(errs, validateItemDef(defs, toolTags, itemTags, defs[id])...)
+	}
+
+	errs = append(errs, findExpansionCycles(defs, ids)...)
+
+	return errors.Join(errs...)
+}
+
+func validateItemDef(defs map[int32]*ItemDef, toolTags, itemTags map[KeyValuePair]bool, def *ItemDef) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{
+			File: def.File,
+			ID:   def.ID,
+			Msg:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	expands := false
+	switch def.Type {
+	case "item", "tag_tool":
+	case "bundle", "generator", "playtimegenerator":
+		expands = true
+
+		if len(def.Bundle) == 0 {
+			fail("%s has an empty bundle", def.Type)
+		}
+	case "tag_generator":
+		if def.TagGeneratorName == "" {
+			fail("tag_generator is missing tag_generator_name")
+		}
+		if len(def.TagGeneratorValues) == 0 {
+			fail("tag_generator is missing tag_generator_values")
+		}
+	default:
+		fail("unknown item type %q", def.Type)
+	}
+
+	if !expands && len(def.Bundle) != 0 {
+		fail("bundle is not allowed on %s", def.Type)
+	}
+
+	for _, b := range def.Bundle {
+		target, ok := defs[b.Item]
+		if !ok {
+			fail("bundle references unknown item %d", b.Item)
+		} else if target.Type == "tag_generator" {
+			fail("bundle references tag_generator %d", b.Item)
+		}
+	}
+
+	if len(def.TagGenerators) != 0 && def.Type != "generator" && def.Type != "playtimegenerator" {
+		fail("tag_generators is not allowed on %s", def.Type)
+	}
+
+	for _, tgid := range def.TagGenerators {
+		tgdef, ok := defs[tgid]
+		if !ok {
+			fail("tag_generators references unknown item %d", tgid)
+
+			continue
+		}
+
+		if tgdef.Type != "tag_generator" {
+			fail("tag_generators references item %d with type %s (expected tag_generator)", tgid, tgdef.Type)
+
+			continue
+		}
+
+		// generated tags that land on an item's accessory tag must
+		// refer to a tag tool, or they can't be displayed.
+		for _, b := range def.Bundle {
+			target := defs[b.Item]
+			if target == nil || target.AccessoryTag != tgdef.TagGeneratorName {
+				continue
+			}
+
+			for _, option := range tgdef.TagGeneratorValues {
+				if msg := checkAccessoryTarget(defs, option.Value); msg != "" {
+					fail("tag_generator %d generates %s:%s for item %d, but %s", tgid, tgdef.TagGeneratorName, option.Value, b.Item, msg)
+				}
+			}
+		}
+	}
+
+	for _, kv := range def.AllowedTagsFromTools {
+		if !toolTags[kv] {
+			fail("allowed_tags_from_tools value %s:%s is not applied by any tag_tool", kv.Key, kv.Value)
+		}
+
+		if def.AccessoryTag != "" && kv.Key == def.AccessoryTag {
+			if msg := checkAccessoryTarget(defs, kv.Value); msg != "" {
+				fail("allowed_tags_from_tools value %s:%s: %s", kv.Key, kv.Value, msg)
+			}
+		}
+	}
+
+	if def.AccessoryTag != "" {
+		for _, kv := range def.Tags {
+			if kv.Key != def.AccessoryTag {
+				continue
+			}
+
+			if msg := checkAccessoryTarget(defs, kv.Value); msg != "" {
+				fail("accessory tag %s:%s: %s", kv.Key, kv.Value, msg)
+			}
+		}
+	}
+
+	if len(def.Exchange) != 0 && def.Type == "tag_generator" {
+		fail("exchange is not allowed on %s", def.Type)
+	}
+
+	for i, recipe := range def.Exchange {
+		for _, input := range recipe {
+			if input.Item == 0 {
+				if !itemTags[input.Tag] {
+					fail("exchange recipe %d requires tag %s:%s, which no item can have", i+1, input.Tag.Key, input.Tag.Value)
+				}
+
+				continue
+			}
+
+			target, ok := defs[input.Item]
+			if !ok {
+				fail("exchange recipe %d references unknown item %d", i+1, input.Item)
+			} else if target.Type != "item" && target.Type != "tag_tool" {
+				fail("exchange recipe %d references item %d with type %s (expected item or tag_tool)", i+1, input.Item, target.Type)
+			}
+		}
+	}
+
+	for _, e := range undeclaredProperties(def) {
+		fail("%s uses dynamic property %s, which is not in compressed_dynamic_props", e.Field, e.Property)
+	}
+
+	return errs
+}
+
+// checkAccessoryTarget returns a description of the problem if value is not
+// the itemdefid of a tag tool, or an empty string if it is.
+func checkAccessoryTarget(defs map[int32]*ItemDef, value string) string {
+	id, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return fmt.Sprintf("%q is not an item id", value)
+	}
+
+	target, ok := defs[int32(id)]
+	if !ok {
+		return fmt.Sprintf("item %d does not exist", id)
+	}
+
+	if target.Type != "tag_tool" {
+		return fmt.Sprintf("item %d has type %s (expected tag_tool)", id, target.Type)
+	}
+
+	return ""
+}
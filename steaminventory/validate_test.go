@@ -0,0 +1,156 @@
+package steaminventory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateItemDefs(t *testing.T) {
+	// validDefs returns a schema with one of each kind of reference, which
+	// each test case breaks in its own way
+	validDefs := func() map[int32]*ItemDef {
+		return map[int32]*ItemDef{
+			1: {ID: 1, Type: "item", AccessoryTag: "strange", AllowedTagsFromTools: KeyValuePairs{{Key: "strange", Value: "5"}}},
+			2: {ID: 2, Type: "bundle", Bundle: BundleDefs{{Item: 1, Quantity: 2}}},
+			3: {ID: 3, Type: "generator", Bundle: BundleDefs{{Item: 1, Quantity: 1}}, TagGenerators: IDList{4}},
+			4: {ID: 4, Type: "tag_generator", TagGeneratorName: "quality", TagGeneratorValues: ValueWeightPairs{{Value: "unique", Weight: 1}}},
+			5: {ID: 5, Type: "tag_tool", Tags: KeyValuePairs{{Key: "strange", Value: "5"}}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(defs map[int32]*ItemDef)
+
+		// each problem that should be reported, in order
+		errs []string
+	}{
+		{name: "valid"},
+		{
+			name: "dangling bundle reference",
+			change: func(defs map[int32]*ItemDef) {
+				defs[2].Bundle = BundleDefs{{Item: 9, Quantity: 1}}
+			},
+			errs: []string{"item 2: bundle references unknown item 9"},
+		},
+		{
+			name: "dangling tag generator",
+			change: func(defs map[int32]*ItemDef) {
+				defs[3].TagGenerators = IDList{9}
+			},
+			errs: []string{"item 3: tag_generators references unknown item 9"},
+		},
+		{
+			name: "invalid type",
+			change: func(defs map[int32]*ItemDef) {
+				defs[1].Type = "hat"
+			},
+			errs: []string{`item 1: unknown item type "hat"`},
+		},
+		{
+			name: "tag generator in bundle",
+			change: func(defs map[int32]*ItemDef) {
+				defs[2].Bundle = BundleDefs{{Item: 4, Quantity: 1}}
+			},
+			errs: []string{"item 2: bundle references tag_generator 4"},
+		},
+		{
+			name: "tag generator of wrong type",
+			change: func(defs map[int32]*ItemDef) {
+				defs[3].TagGenerators = IDList{1}
+			},
+			errs: []string{"item 3: tag_generators references item 1 with type item (expected tag_generator)"},
+		},
+		{
+			name: "accessory tag on an item",
+			change: func(defs map[int32]*ItemDef) {
+				defs[5].Tags = KeyValuePairs{{Key: "strange", Value: "2"}}
+				defs[1].AllowedTagsFromTools = KeyValuePairs{{Key: "strange", Value: "2"}}
+			},
+			errs: []string{"item 1: allowed_tags_from_tools value strange:2: item 2 has type bundle (expected tag_tool)"},
+		},
+		{
+			name: "dangling exchange reference",
+			change: func(defs map[int32]*ItemDef) {
+				defs[1].Exchange = ExchangeRecipes{{{Item: 9, Quantity: 1}}}
+			},
+			errs: []string{"item 1: exchange recipe 1 references unknown item 9"},
+		},
+		{
+			name: "exchange for a tag no item has",
+			change: func(defs map[int32]*ItemDef) {
+				defs[1].Exchange = ExchangeRecipes{{{Item: 5, Quantity: 1}}, {{Tag: KeyValuePair{Key: "quality", Value: "normal"}, Quantity: 1}}}
+			},
+			errs: []string{"item 1: exchange recipe 2 requires tag quality:normal, which no item can have"},
+		},
+		{
+			name: "undeclared dynamic property",
+			change: func(defs map[int32]*ItemDef) {
+				defs[1].Description = "%kills% kills"
+			},
+			errs: []string{"item 1: description uses dynamic property kills, which is not in compressed_dynamic_props"},
+		},
+		{
+			name: "several problems",
+			change: func(defs map[int32]*ItemDef) {
+				defs[1].Type = "hat"
+				defs[2].Bundle = BundleDefs{{Item: 9, Quantity: 1}}
+				defs[3].Bundle = nil
+				defs[4].TagGeneratorValues = nil
+			},
+			errs: []string{
+				`item 1: unknown item type "hat"`,
+				"item 2: bundle references unknown item 9",
+				"item 3: generator has an empty bundle",
+				"item 4: tag_generator is missing tag_generator_values",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := validDefs()
+			for _, def := range defs {
+				def.File = "test.json"
+			}
+
+			if tt.change != nil {
+				tt.change(defs)
+			}
+
+			err := validateItemDefs(defs)
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected validation errors")
+			}
+
+			var errs []error
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			}
+
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(tt.errs), err)
+			}
+
+			for i, want := range tt.errs {
+				var verr *ValidationError
+				if !errors.As(errs[i], &verr) || verr.File != "test.json" {
+					t.Errorf("error %d is not a ValidationError from test.json: %v", i, errs[i])
+				}
+
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("error %d is %q, want %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// The store directory holds a snapshot and a journal split into segments.
+// Each segment is named after the sequence number of its first entry and
+// holds one JSON entry per line. Every snapshotInterval entries, a snapshot
+// is written and a new segment is started, so opening the store only
+// replays the entries written since the last snapshot.
+const (
+	snapshotFile     = "snapshot.json"
+	scenarioFile     = "scenario.json"
+	journalPrefix    = "journal-"
+	journalSuffix    = ".jsonl"
+	snapshotInterval = 1000
+)
+
+// PlayerState is everything the store keeps about a player other than their
+// items.
+type PlayerState struct {
+	Playtime      time.Duration                       `json:"playtime"`
+	Drops         map[int32]*steaminventory.DropState `json:"drops,omitempty"`
+	Classes       []string                            `json:"classes,omitempty"`
+	ClaimedPromos map[int32]bool                      `json:"claimed_promos,omitempty"`
+	Days          int32                               `json:"days,omitempty"`
+}
+
+// ItemChange is the state of an item before and after a journal entry. The
+// item was created if Before is nil, and removed if After is nil.
+type ItemChange struct {
+	ItemID uint64                    `json:"itemid,string"`
+	Before *steaminventory.SteamItem `json:"before,omitempty"`
+	After  *steaminventory.SteamItem `json:"after,omitempty"`
+}
+
+// JournalEntry records one change to one player's inventory. Action is the
+// Web API method or simulation step that made the change, and Origin is the
+// origin of any items it created. Player is only set if the player's state
+// changed.
+type JournalEntry struct {
+	Seq     uint64       `json:"seq"`
+	Time    time.Time    `json:"time"`
+	SteamID uint64       `json:"steamid,string"`
+	Action  string       `json:"action"`
+	Origin  string       `json:"origin,omitempty"`
+	Changes []ItemChange `json:"changes,omitempty"`
+	Player  *PlayerState `json:"player,omitempty"`
+}
+
+// StoreScenario identifies the scenario and seed that simulated the players
+// in a store.
+type StoreScenario struct {
+	Hash string `json:"hash"`
+	Seed int64  `json:"seed"`
+}
+
+// StoreSnapshot is every player's state after the journal entry Seq.
+type StoreSnapshot struct {
+	Seq        uint64         `json:"seq"`
+	LastItemID uint64         `json:"last_itemid,string"`
+	Players    []StoredPlayer `json:"players"`
+}
+
+type StoredPlayer struct {
+	SteamID uint64                     `json:"steamid,string"`
+	State   PlayerState                `json:"state"`
+	Items   []steaminventory.SteamItem `json:"items"`
+}
+
+// storedPlayer is a player as of the last journal entry.
+type storedPlayer struct {
+	state PlayerState
+	items map[uint64]steaminventory.SteamItem
+}
+
+// InventoryStore saves players' inventories to a directory as an
+// append-only journal, so they can be rebuilt after a restart. Entries are
+// not synced to disk one by one; Close writes a snapshot and syncs it.
+// It is safe to use from multiple goroutines, but each player must only be
+// changed by one goroutine at a time.
+type InventoryStore struct {
+	dir string
+
+	mu          sync.Mutex
+	journal     *os.File
+	seq         uint64
+	snapshotSeq uint64
+	lastItemID  uint64
+	stored      map[uint64]*storedPlayer
+	players     map[uint64]*steaminventory.SimulatedPlayer
+	ids         *steaminventory.ItemIDAllocator
+
+	// nil until a scenario is simulated in the store
+	scenario *StoreScenario
+
+	// the first error writing the journal; nothing is written after it
+	err error
+}
+
+// openInventoryStore loads the snapshot in dir and replays the journal
+// entries written after it. The directory is created if it doesn't exist.
+func openInventoryStore(dir string) (*InventoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	st := &InventoryStore{
+		dir:     dir,
+		stored:  make(map[uint64]*storedPlayer),
+		players: make(map[uint64]*steaminventory.SimulatedPlayer),
+	}
+
+	if err := st.loadScenario(); err != nil {
+		return nil, err
+	}
+
+	if err := st.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	segments, err := st.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, first := range segments {
+		// segments are only started after a snapshot, so a segment that
+		// starts before the snapshot is entirely included in it
+		if first <= st.snapshotSeq {
+			continue
+		}
+
+		if err = st.replay(first, i == len(segments)-1); err != nil {
+			return nil, err
+		}
+	}
+
+	first := st.seq + 1
+	if n := len(segments); n != 0 && segments[n-1] > st.snapshotSeq {
+		first = segments[n-1]
+	}
+
+	st.journal, err = os.OpenFile(st.segmentName(first), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	st.ids = steaminventory.NewItemIDAllocator(st.lastItemID)
+
+	return st, nil
+}
+
+func (st *InventoryStore) segmentName(first uint64) string {
+	return filepath.Join(st.dir, fmt.Sprintf("%s%020d%s", journalPrefix, first, journalSuffix))
+}
+
+// segments returns the first sequence number of each journal segment in
+// order.
+func (st *InventoryStore) segments() ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(st.dir, journalPrefix+"*"+journalSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []uint64
+	for _, name := range names {
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), journalPrefix), journalSuffix), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: not a journal segment", name)
+		}
+
+		segments = append(segments, first)
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+
+	return segments, nil
+}
+
+func (st *InventoryStore) loadScenario() error {
+	name := filepath.Join(st.dir, scenarioFile)
+
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	st.scenario = new(StoreScenario)
+	if err = json.Unmarshal(b, st.scenario); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// useScenario checks that the players in the store were simulated with the
+// scenario with the given hash and seed, so they can be loaded instead of
+// being simulated again. The first scenario simulated in the store is saved
+// in it.
+func (st *InventoryStore) useScenario(hash string, seed int64) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.scenario != nil {
+		if st.scenario.Hash != hash || st.scenario.Seed != seed {
+			return fmt.Errorf("%s holds players simulated with a different scenario or seed", st.dir)
+		}
+
+		return nil
+	}
+
+	scenario := &StoreScenario{Hash: hash, Seed: seed}
+	if err := writeFileSync(filepath.Join(st.dir, scenarioFile), scenario); err != nil {
+		return err
+	}
+
+	st.scenario = scenario
+
+	return nil
+}
+
+func (st *InventoryStore) loadSnapshot() error {
+	name := filepath.Join(st.dir, snapshotFile)
+
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snapshot StoreSnapshot
+	if err = json.Unmarshal(b, &snapshot); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	for _, player := range snapshot.Players {
+		stored := st.storedPlayer(player.SteamID)
+		stored.state = player.State
+
+		for _, item := range player.Items {
+			if err = checkStoredItem(item); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			stored.items[item.ItemID] = item
+		}
+	}
+
+	st.seq = snapshot.Seq
+	st.snapshotSeq = snapshot.Seq
+	st.lastItemID = snapshot.LastItemID
+
+	return nil
+}
+
+// replay applies every entry in a journal segment. If the process stopped
+// while an entry was being written to the last segment, the partial entry
+// is removed.
+func (st *InventoryStore) replay(first uint64, last bool) error {
+	name := st.segmentName(first)
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	offset := int64(0)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) == 0 {
+				return nil
+			}
+
+			if !last {
+				return fmt.Errorf("%s: incomplete entry at offset %d", name, offset)
+			}
+
+			return os.Truncate(name, offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry JournalEntry
+		if err = json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("%s: offset %d: %w", name, offset, err)
+		}
+
+		if entry.Seq != st.seq+1 {
+			return fmt.Errorf("%s: expected entry %d, but found entry %d", name, st.seq+1, entry.Seq)
+		}
+
+		if err = st.apply(&entry); err != nil {
+			return fmt.Errorf("%s: entry %d: %w", name, entry.Seq, err)
+		}
+
+		offset += int64(len(line))
+	}
+}
+
+func checkStoredItem(item steaminventory.SteamItem) error {
+	if _, err := time.Parse(steaminventory.SteamTimeFormat, item.Acquired); err != nil {
+		return fmt.Errorf("item %d: %w", item.ItemID, err)
+	}
+
+	return nil
+}
+
+func (st *InventoryStore) storedPlayer(steamID uint64) *storedPlayer {
+	stored, ok := st.stored[steamID]
+	if !ok {
+		stored = &storedPlayer{items: make(map[uint64]steaminventory.SteamItem)}
+		st.stored[steamID] = stored
+	}
+
+	return stored
+}
+
+// apply updates the stored state of a player with a journal entry.
+func (st *InventoryStore) apply(entry *JournalEntry) error {
+	stored := st.storedPlayer(entry.SteamID)
+
+	for _, change := range entry.Changes {
+		if change.ItemID > st.lastItemID {
+			st.lastItemID = change.ItemID
+		}
+
+		if change.After == nil {
+			delete(stored.items, change.ItemID)
+
+			continue
+		}
+
+		if err := checkStoredItem(*change.After); err != nil {
+			return err
+		}
+
+		stored.items[change.ItemID] = *change.After
+	}
+
+	if entry.Player != nil {
+		stored.state = *entry.Player
+	}
+
+	st.seq = entry.Seq
+
+	return nil
+}
+
+// player returns the player with the given Steam ID, as of the last journal
+// entry for them. Changes to the player must be passed to record.
+func (st *InventoryStore) player(steamID uint64) *steaminventory.SimulatedPlayer {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if p, ok := st.players[steamID]; ok {
+		return p
+	}
+
+	p := steaminventory.NewSimulatedPlayer(st.ids)
+	if stored, ok := st.stored[steamID]; ok {
+		stored.state.restore(p)
+
+		ids := make([]uint64, 0, len(stored.items))
+		for id := range stored.items {
+			ids = append(ids, id)
+		}
+
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+
+		for _, id := range ids {
+			p.Inventory.Items = append(p.Inventory.Items, stored.items[id].Instance())
+		}
+	}
+
+	st.players[steamID] = p
+
+	return p
+}
+
+// record writes a journal entry for the items in changed, which includes
+// items that were removed, and for any change to the player's state. Nothing
+// is written if nothing changed.
+func (st *InventoryStore) record(steamID uint64, action string, now time.Time, player *steaminventory.SimulatedPlayer, changed []*steaminventory.ItemInstance) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.err != nil {
+		return st.err
+	}
+
+	stored := st.storedPlayer(steamID)
+	entry := &JournalEntry{
+		Time:    now,
+		SteamID: steamID,
+		Action:  action,
+	}
+
+	seen := make(map[uint64]bool, len(changed))
+	for _, item := range changed {
+		if seen[item.ItemID] {
+			continue
+		}
+		seen[item.ItemID] = true
+
+		change := ItemChange{ItemID: item.ItemID}
+		if before, ok := stored.items[item.ItemID]; ok {
+			change.Before = &before
+		}
+
+		if item.Quantity != 0 {
+			after := steaminventory.NewSteamItem(item)
+			change.After = &after
+		}
+
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+
+		if change.Before != nil && change.After != nil && reflect.DeepEqual(*change.Before, *change.After) {
+			continue
+		}
+
+		if change.Before == nil && entry.Origin == "" {
+			entry.Origin = change.After.Origin
+		}
+
+		entry.Changes = append(entry.Changes, change)
+	}
+
+	if state := playerState(player); !reflect.DeepEqual(state, stored.state) {
+		entry.Player = &state
+	}
+
+	if len(entry.Changes) == 0 && entry.Player == nil {
+		return nil
+	}
+
+	return st.write(entry)
+}
+
+// reset removes every item and all progress from a player and returns the
+// empty player.
+func (st *InventoryStore) reset(steamID uint64, action string, now time.Time) (*steaminventory.SimulatedPlayer, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	p := steaminventory.NewSimulatedPlayer(st.ids)
+	st.players[steamID] = p
+
+	if st.err != nil {
+		return p, st.err
+	}
+
+	stored, ok := st.stored[steamID]
+	if !ok {
+		return p, nil
+	}
+
+	entry := &JournalEntry{
+		Time:    now,
+		SteamID: steamID,
+		Action:  action,
+	}
+
+	for id, item := range stored.items {
+		before := item
+		entry.Changes = append(entry.Changes, ItemChange{
+			ItemID: id,
+			Before: &before,
+		})
+	}
+
+	sort.Slice(entry.Changes, func(i, j int) bool {
+		return entry.Changes[i].ItemID < entry.Changes[j].ItemID
+	})
+
+	if state := playerState(p); !reflect.DeepEqual(state, stored.state) {
+		entry.Player = &state
+	}
+
+	if len(entry.Changes) == 0 && entry.Player == nil {
+		return p, nil
+	}
+
+	return p, st.write(entry)
+}
+
+func (st *InventoryStore) write(entry *JournalEntry) error {
+	entry.Seq = st.seq + 1
+
+	b, err := json.Marshal(entry)
+	if err == nil {
+		_, err = st.journal.Write(append(b, '\n'))
+	}
+
+	if err == nil {
+		err = st.apply(entry)
+	}
+
+	if err == nil && st.seq-st.snapshotSeq >= snapshotInterval {
+		err = st.snapshot()
+		if err == nil {
+			err = st.startSegment()
+		}
+	}
+
+	st.err = err
+
+	return err
+}
+
+// snapshot writes the state of every player after the last journal entry.
+// The previous snapshot is only replaced once the new one is on disk.
+func (st *InventoryStore) snapshot() error {
+	snapshot := StoreSnapshot{
+		Seq:        st.seq,
+		LastItemID: st.lastItemID,
+		Players:    make([]StoredPlayer, 0, len(st.stored)),
+	}
+
+	for steamID, stored := range st.stored {
+		player := StoredPlayer{
+			SteamID: steamID,
+			State:   stored.state,
+			Items:   make([]steaminventory.SteamItem, 0, len(stored.items)),
+		}
+
+		for _, item := range stored.items {
+			player.Items = append(player.Items, item)
+		}
+
+		sort.Slice(player.Items, func(i, j int) bool {
+			return player.Items[i].ItemID < player.Items[j].ItemID
+		})
+
+		snapshot.Players = append(snapshot.Players, player)
+	}
+
+	sort.Slice(snapshot.Players, func(i, j int) bool {
+		return snapshot.Players[i].SteamID < snapshot.Players[j].SteamID
+	})
+
+	if err := writeFileSync(filepath.Join(st.dir, snapshotFile), snapshot); err != nil {
+		return err
+	}
+
+	st.snapshotSeq = st.seq
+
+	return nil
+}
+
+// writeFileSync writes v as JSON to a file and syncs it. The file is only
+// replaced once the new contents are on disk.
+func writeFileSync(name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+// startSegment closes the current journal segment and starts a new one
+// after a snapshot.
+func (st *InventoryStore) startSegment() error {
+	if err := st.closeJournal(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(st.segmentName(st.seq+1), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	st.journal = f
+
+	return nil
+}
+
+func (st *InventoryStore) closeJournal() error {
+	err := st.journal.Sync()
+	if closeErr := st.journal.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Close writes a snapshot if anything changed since the last one and
+// closes the journal. It returns the first error writing the journal.
+func (st *InventoryStore) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.err == nil && st.seq != st.snapshotSeq {
+		st.err = st.snapshot()
+	}
+
+	if err := st.closeJournal(); st.err == nil {
+		st.err = err
+	}
+
+	return st.err
+}
+
+// playerState returns a copy of everything about p other than its items.
+func playerState(p *steaminventory.SimulatedPlayer) PlayerState {
+	state := PlayerState{
+		Playtime: p.Playtime,
+		Days:     p.Days,
+	}
+
+	for id, drop := range p.Drops {
+		if state.Drops == nil {
+			state.Drops = make(map[int32]*steaminventory.DropState)
+		}
+
+		copied := *drop
+		state.Drops[id] = &copied
+	}
+
+	if len(p.Classes) != 0 {
+		state.Classes = append([]string(nil), p.Classes...)
+	}
+
+	for id, claimed := range p.ClaimedPromos {
+		if state.ClaimedPromos == nil {
+			state.ClaimedPromos = make(map[int32]bool)
+		}
+
+		state.ClaimedPromos[id] = claimed
+	}
+
+	return state
+}
+
+func (state PlayerState) restore(p *steaminventory.SimulatedPlayer) {
+	p.Playtime = state.Playtime
+	p.Days = state.Days
+
+	for id, drop := range state.Drops {
+		copied := *drop
+		p.Drops[id] = &copied
+	}
+
+	p.Classes = append([]string(nil), state.Classes...)
+
+	for id, claimed := range state.ClaimedPromos {
+		if p.ClaimedPromos == nil {
+			p.ClaimedPromos = make(map[int32]bool)
+		}
+
+		p.ClaimedPromos[id] = claimed
+	}
+}
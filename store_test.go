@@ -0,0 +1,463 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// fillStore records entries changes for player 1, alternating between
+// adding an item, changing an item's tags, and adding playtime. It returns
+// the player's items and state as the store should have them.
+func fillStore(t *testing.T, st *InventoryStore, entries int) ([]steaminventory.SteamItem, PlayerState) {
+	t.Helper()
+
+	p := st.player(1)
+	now := scenarioStart
+
+	var last *steaminventory.ItemInstance
+	for i := 0; i < entries; i++ {
+		now = now.Add(time.Minute)
+
+		var changed []*steaminventory.ItemInstance
+		switch {
+		case i%3 == 1 && last != nil:
+			last.Tags = steaminventory.KeyValuePairs{{Key: "entry", Value: now.Format(time.RFC3339)}}
+			changed = append(changed, last)
+		case i%3 == 2:
+			p.Play(time.Minute)
+		default:
+			last = p.Inventory.Add(1, int32(i+1), nil, now, "test")
+			changed = append(changed, last)
+		}
+
+		if err := st.record(1, "test", now, p, changed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return sortedStoredItems(p), playerState(p)
+}
+
+func sortedStoredItems(p *steaminventory.SimulatedPlayer) []steaminventory.SteamItem {
+	items := make([]steaminventory.SteamItem, 0, len(p.Inventory.Items))
+	for _, item := range p.Inventory.Items {
+		items = append(items, steaminventory.NewSteamItem(item))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ItemID < items[j].ItemID
+	})
+
+	return items
+}
+
+// crashStore closes the journal without writing a snapshot, as if the
+// process had stopped.
+func crashStore(t *testing.T, st *InventoryStore) {
+	t.Helper()
+
+	if err := st.journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendToFile(t *testing.T, name, text string) {
+	t.Helper()
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInventoryStoreReopen(t *testing.T) {
+	const partialEntry = `{"seq":`
+
+	tests := []struct {
+		name    string
+		entries int
+		crash   bool
+
+		// damage changes the files in the store's directory before it is
+		// opened again. It returns the journal segment that should have
+		// been truncated, if any.
+		damage func(t *testing.T, st *InventoryStore) string
+
+		wantErr bool
+	}{
+		{name: "close", entries: 10},
+		{name: "crash", entries: 10, crash: true},
+		{name: "empty", entries: 0, crash: true},
+		{name: "crash after snapshot", entries: snapshotInterval + 10, crash: true},
+		{name: "close after snapshot", entries: snapshotInterval + 10},
+		{
+			name:    "partial entry",
+			entries: 10,
+			crash:   true,
+			damage: func(t *testing.T, st *InventoryStore) string {
+				name := st.segmentName(1)
+				appendToFile(t, name, partialEntry)
+
+				return name
+			},
+		},
+		{
+			name:    "partial entry after snapshot",
+			entries: snapshotInterval + 10,
+			crash:   true,
+			damage: func(t *testing.T, st *InventoryStore) string {
+				name := st.segmentName(snapshotInterval + 1)
+				appendToFile(t, name, partialEntry)
+
+				return name
+			},
+		},
+		{
+			name:    "partial entry in earlier segment",
+			entries: snapshotInterval + 10,
+			crash:   true,
+			damage: func(t *testing.T, st *InventoryStore) string {
+				// without the snapshot, the first segment is replayed too
+				if err := os.Remove(filepath.Join(st.dir, snapshotFile)); err != nil {
+					t.Fatal(err)
+				}
+
+				appendToFile(t, st.segmentName(1), partialEntry)
+
+				return ""
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing entry",
+			entries: 10,
+			crash:   true,
+			damage: func(t *testing.T, st *InventoryStore) string {
+				appendToFile(t, st.segmentName(1), `{"seq":100,"steamid":"1","action":"test"}`+"\n")
+
+				return ""
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			st, err := openInventoryStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantItems, wantState := fillStore(t, st, tt.entries)
+
+			if tt.crash {
+				crashStore(t, st)
+			} else if err = st.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var truncated string
+			var wantSize int64
+			if tt.damage != nil {
+				if tt.crash {
+					info, err := os.Stat(st.segmentName(st.seq - st.seq%snapshotInterval + 1))
+					if err == nil {
+						wantSize = info.Size()
+					}
+				}
+
+				truncated = tt.damage(t, st)
+			}
+
+			reopened, err := openInventoryStore(dir)
+			if tt.wantErr {
+				if err == nil {
+					reopened.Close()
+					t.Fatal("expected an error opening the store")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+
+			if reopened.seq != uint64(tt.entries) {
+				t.Errorf("sequence number %d, want %d", reopened.seq, tt.entries)
+			}
+
+			p := reopened.player(1)
+			if got := sortedStoredItems(p); !reflect.DeepEqual(got, wantItems) {
+				t.Errorf("items %+v, want %+v", got, wantItems)
+			}
+
+			if got := playerState(p); !reflect.DeepEqual(got, wantState) {
+				t.Errorf("player state %+v, want %+v", got, wantState)
+			}
+
+			if truncated != "" {
+				info, err := os.Stat(truncated)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if info.Size() != wantSize {
+					t.Errorf("%s is %d bytes, want %d", filepath.Base(truncated), info.Size(), wantSize)
+				}
+			}
+
+			// new entries go after the replayed ones
+			item := p.Inventory.Add(1, 1, nil, scenarioStart, "test")
+			if n := len(wantItems); n != 0 && item.ItemID <= wantItems[n-1].ItemID {
+				t.Errorf("new item id %d reuses a stored item id", item.ItemID)
+			}
+
+			if err = reopened.record(1, "test", scenarioStart, p, []*steaminventory.ItemInstance{item}); err != nil {
+				t.Fatal(err)
+			}
+
+			if reopened.seq != uint64(tt.entries)+1 {
+				t.Errorf("sequence number after recording %d, want %d", reopened.seq, tt.entries+1)
+			}
+		})
+	}
+}
+
+func TestScenarioRunStore(t *testing.T) {
+	const seed = 7
+
+	tests := []struct {
+		name     string
+		scenario string
+		change   func(s *Scenario)
+		seed     int64
+
+		// fill runs the scenario with seed in the store first
+		fill bool
+		// crash closes the journal before the scenario is run
+		crash bool
+
+		wantErr bool
+	}{
+		{name: "fresh", scenario: "scenarios/strange-counters.json", seed: seed},
+		{name: "same scenario and seed", scenario: "scenarios/strange-counters.json", seed: seed, fill: true},
+		{name: "other seed", scenario: "scenarios/strange-counters.json", seed: seed + 1, fill: true, wantErr: true},
+		{
+			name:     "other scenario",
+			scenario: "scenarios/strange-counters.json",
+			change: func(s *Scenario) {
+				s.Days--
+			},
+			seed:    seed,
+			fill:    true,
+			wantErr: true,
+		},
+		{name: "drop pools", scenario: "scenarios/reactive-drop-daily.json", seed: seed, wantErr: true},
+		{name: "journal error", scenario: "scenarios/strange-counters.json", seed: seed, crash: true, wantErr: true},
+	}
+
+	defs := testItemDefs(t)
+
+	load := func(t *testing.T, name string) *Scenario {
+		t.Helper()
+
+		s, err := loadScenario(name, defs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the guaranteed rare drops after 100 hours of playtime
+		s.Players = 3
+		s.Days = 120
+
+		return s
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var filled steaminventory.TaggedBundleDefs
+			var filledSeq uint64
+			if tt.fill {
+				st, err := openInventoryStore(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				filled, _, err = load(t, "scenarios/strange-counters.json").run(defs, seed, 2, false, st)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				filledSeq = st.seq
+				if err = st.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			st, err := openInventoryStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.crash {
+				crashStore(t, st)
+			}
+
+			s := load(t, tt.scenario)
+			if tt.change != nil {
+				tt.change(s)
+			}
+
+			items, _, err := s.run(defs, tt.seed, 2, false, st)
+			if !tt.crash {
+				if closeErr := st.Close(); closeErr != nil {
+					t.Fatal(closeErr)
+				}
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error running the scenario")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(items) == 0 {
+				t.Error("the players got no items")
+			}
+
+			want, _, err := s.run(defs, tt.seed, 2, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(items, want) {
+				t.Errorf("got items %+v, want %+v", items, want)
+			}
+
+			if tt.fill {
+				if !reflect.DeepEqual(items, filled) {
+					t.Errorf("got items %+v, but the store was filled with %+v", items, filled)
+				}
+
+				if st.seq != filledSeq {
+					t.Errorf("players were simulated again: sequence number %d, want %d", st.seq, filledSeq)
+				}
+			}
+		})
+	}
+}
+
+func TestInventoryStoreTagChanges(t *testing.T) {
+	const steamID = steamIDBase + 1
+
+	modify := func(t *testing.T, s *InventoryService, updates string) {
+		t.Helper()
+
+		input := `{"steamid":"` + strconv.FormatUint(steamID, 10) + `","updates":` + updates + `}`
+		if status, _, body := callAPI(t, s, http.MethodPost, "ModifyItems", url.Values{"input_json": {input}}); status != http.StatusOK {
+			t.Fatalf("ModifyItems: %s", body)
+		}
+	}
+
+	applyTool := func(t *testing.T, s *InventoryService, granted []*steaminventory.ItemInstance) {
+		modify(t, s, `[{"itemid":"`+strconv.FormatUint(granted[1].ItemID, 10)+`","tool_itemid":"`+strconv.FormatUint(granted[0].ItemID, 10)+`"}]`)
+	}
+
+	tests := []struct {
+		name string
+
+		// granted is the items 5000, 3001 and 4000
+		call func(t *testing.T, s *InventoryService, granted []*steaminventory.ItemInstance)
+	}{
+		{name: "apply tag tool", call: applyTool},
+		{
+			name: "set counter",
+			call: func(t *testing.T, s *InventoryService, granted []*steaminventory.ItemInstance) {
+				applyTool(t, s, granted)
+				modify(t, s, `[{"itemid":"`+strconv.FormatUint(granted[1].ItemID, 10)+`","property_name":"strange_5000","property_value_int":5}]`)
+			},
+		},
+		{
+			name: "extract device",
+			call: func(t *testing.T, s *InventoryService, granted []*steaminventory.ItemInstance) {
+				applyTool(t, s, granted)
+
+				status, _, body := callAPI(t, s, http.MethodPost, "ExchangeItem", url.Values{
+					"steamid":              {strconv.FormatUint(steamID, 10)},
+					"outputitemdefid":      {"5000"},
+					"materialsitemid[0]":   {strconv.FormatUint(granted[2].ItemID, 10)},
+					"materialsquantity[0]": {"1"},
+					"materialsitemid[1]":   {strconv.FormatUint(granted[1].ItemID, 10)},
+					"materialsquantity[1]": {"1"},
+				})
+				if status != http.StatusOK {
+					t.Fatalf("ExchangeItem: %s", body)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := testItemDefs(t)
+			dir := t.TempDir()
+
+			st, err := openInventoryStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := newTestService(defs)
+			s.store = st
+
+			player := s.playerByID(steamID)
+			granted := player.Inventory.Grant(defs, steaminventory.TaggedBundleDefs{{Item: 5000, Quantity: 1}, {Item: 3001, Quantity: 1}, {Item: 4000, Quantity: 1}}, scenarioStart, steaminventory.OriginExternal)
+			if err = s.record(steamID, "AddItem", player, granted); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.call(t, s, granted)
+
+			want := sortedStoredItems(player)
+
+			crashStore(t, st)
+
+			reopened, err := openInventoryStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+
+			if got := sortedStoredItems(reopened.player(steamID)); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed items %+v, want %+v", got, want)
+			}
+		})
+	}
+}
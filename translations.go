@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+type TranslationReport struct {
+	File           string             `json:"file"`
+	TranslatorNote string             `json:"translator_note,omitempty"`
+	Languages      []LanguageCoverage `json:"languages"`
+}
+
+type LanguageCoverage struct {
+	Language     string                `json:"language"`
+	Translated   int                   `json:"translated"`
+	Total        int                   `json:"total"`
+	Missing      []TranslationField    `json:"missing,omitempty"`
+	Placeholders []PlaceholderMismatch `json:"placeholders,omitempty"`
+}
+
+type TranslationField struct {
+	Item  int32  `json:"itemdefid"`
+	Field string `json:"field"`
+}
+
+type PlaceholderMismatch struct {
+	TranslationField
+
+	Expected []string `json:"expected"`
+	Found    []string `json:"found"`
+}
+
+// translationReports checks the translations of every item that can be in
+// an inventory. A field needs a translation if its untranslated or English
+// text is set. The untranslated field is the English text, so it counts as
+// the English translation. Languages that the schema format has no field for
+// are not counted.
+func translationReports(defs map[int32]*steaminventory.ItemDef, files []*steaminventory.SchemaFile) []TranslationReport {
+	reports := make([]TranslationReport, len(files))
+
+	for i, file := range files {
+		reports[i] = TranslationReport{
+			File:           file.Name,
+			TranslatorNote: file.TranslatorNote,
+			Languages:      make([]LanguageCoverage, len(steaminventory.Languages)),
+		}
+
+		for j, lang := range steaminventory.Languages {
+			coverage := &reports[i].Languages[j]
+			coverage.Language = lang
+
+			for _, id := range file.Items {
+				def := defs[id]
+				if def.Type != "item" && def.Type != "tag_tool" {
+					continue
+				}
+
+				checkTranslations(def, lang, coverage)
+			}
+		}
+	}
+
+	return reports
+}
+
+func checkTranslations(def *steaminventory.ItemDef, lang string, coverage *LanguageCoverage) {
+	for _, base := range steaminventory.LocalizedBases {
+		if _, ok := steaminventory.LocalizedFields[base+"_"+lang]; !ok {
+			continue
+		}
+
+		source := def.Localized(base, "english")
+		if source == "" {
+			continue
+		}
+
+		field := TranslationField{
+			Item:  def.ID,
+			Field: base + "_" + lang,
+		}
+
+		coverage.Total++
+
+		translated := def.LocalizedField(field.Field)
+		if translated == "" && lang == "english" {
+			translated = def.LocalizedField(base)
+		}
+
+		if translated == "" {
+			coverage.Missing = append(coverage.Missing, field)
+
+			continue
+		}
+
+		coverage.Translated++
+
+		expected := placeholders(source)
+		found := placeholders(translated)
+		if strings.Join(expected, " ") != strings.Join(found, " ") {
+			coverage.Placeholders = append(coverage.Placeholders, PlaceholderMismatch{
+				TranslationField: field,
+				Expected:         expected,
+				Found:            found,
+			})
+		}
+	}
+}
+
+// placeholders returns the sorted %placeholder% tokens in s.
+func placeholders(s string) []string {
+	tokens := steaminventory.PlaceholderPattern.FindAllString(s, -1)
+	sort.Strings(tokens)
+
+	return tokens
+}
+
+// languageTotals adds up the coverage of each language over every report.
+func languageTotals(reports []TranslationReport) []LanguageCoverage {
+	totals := make([]LanguageCoverage, len(steaminventory.Languages))
+	for i, lang := range steaminventory.Languages {
+		totals[i].Language = lang
+
+		for _, report := range reports {
+			totals[i].Translated += report.Languages[i].Translated
+			totals[i].Total += report.Languages[i].Total
+			totals[i].Missing = append(totals[i].Missing, report.Languages[i].Missing...)
+			totals[i].Placeholders = append(totals[i].Placeholders, report.Languages[i].Placeholders...)
+		}
+	}
+
+	return totals
+}
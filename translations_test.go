@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+func TestCheckTranslations(t *testing.T) {
+	tests := []struct {
+		name         string
+		def          steaminventory.ItemDef
+		lang         string
+		translated   int
+		total        int
+		missing      []TranslationField
+		placeholders int
+	}{
+		{
+			name:       "base field is english",
+			def:        steaminventory.ItemDef{ID: 1, Name: "Tool", Description: "A tool"},
+			lang:       "english",
+			translated: 2,
+			total:      2,
+		},
+		{
+			name:       "english field",
+			def:        steaminventory.ItemDef{ID: 1, NameEnglish: "Tool"},
+			lang:       "english",
+			translated: 1,
+			total:      1,
+		},
+		{
+			name:    "base field is not german",
+			def:     steaminventory.ItemDef{ID: 1, Name: "Tool"},
+			lang:    "german",
+			total:   1,
+			missing: []TranslationField{{Item: 1, Field: "name_german"}},
+		},
+		{
+			name:       "german",
+			def:        steaminventory.ItemDef{ID: 1, Name: "Tool", NameGerman: "Werkzeug"},
+			lang:       "german",
+			translated: 1,
+			total:      1,
+		},
+		{
+			name:       "english source",
+			def:        steaminventory.ItemDef{ID: 1, NameEnglish: "Tool", DescriptionEnglish: "A tool", DescriptionFrench: "Un outil"},
+			lang:       "french",
+			translated: 1,
+			total:      2,
+			missing:    []TranslationField{{Item: 1, Field: "name_french"}},
+		},
+		{
+			name:         "placeholder mismatch",
+			def:          steaminventory.ItemDef{ID: 1, Description: "%kills% kills", DescriptionGerman: "Tötungen"},
+			lang:         "german",
+			translated:   1,
+			total:        1,
+			placeholders: 1,
+		},
+		{
+			name:       "placeholders in a different order",
+			def:        steaminventory.ItemDef{ID: 1, Description: "%a% and %b%", DescriptionGerman: "%b% und %a%"},
+			lang:       "german",
+			translated: 1,
+			total:      1,
+		},
+		{
+			name: "nothing to translate",
+			def:  steaminventory.ItemDef{ID: 1},
+			lang: "german",
+		},
+		{
+			name: "nothing to translate in english",
+			def:  steaminventory.ItemDef{ID: 1},
+			lang: "english",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coverage LanguageCoverage
+			checkTranslations(&tt.def, tt.lang, &coverage)
+
+			if coverage.Translated != tt.translated || coverage.Total != tt.total {
+				t.Errorf("got %d/%d translated, want %d/%d", coverage.Translated, coverage.Total, tt.translated, tt.total)
+			}
+
+			if !reflect.DeepEqual(coverage.Missing, tt.missing) {
+				t.Errorf("got missing %v, want %v", coverage.Missing, tt.missing)
+			}
+
+			if len(coverage.Placeholders) != tt.placeholders {
+				t.Errorf("got %d placeholder mismatches, want %d", len(coverage.Placeholders), tt.placeholders)
+			}
+		})
+	}
+}
+
+func TestTranslationReportsSkipsGenerators(t *testing.T) {
+	defs := map[int32]*steaminventory.ItemDef{
+		1: {ID: 1, Type: "item", Name: "Tool"},
+		2: {ID: 2, Type: "generator", Name: "Tool Drop"},
+	}
+	files := []*steaminventory.SchemaFile{{Name: "test.json", Items: []int32{1, 2}}}
+
+	reports := translationReports(defs, files)
+	if len(reports) != 1 || len(reports[0].Languages) != len(steaminventory.Languages) {
+		t.Fatalf("got %+v", reports)
+	}
+
+	for _, coverage := range reports[0].Languages {
+		if coverage.Total != 1 {
+			t.Errorf("%s: got %d fields, want only the item's name", coverage.Language, coverage.Total)
+		}
+	}
+}
@@ -0,0 +1,653 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+// APIError is an error returned to a Web API client.
+type APIError struct {
+	Status  int
+	EResult int
+	Msg     string
+}
+
+func (e *APIError) Error() string {
+	return e.Msg
+}
+
+func invalidParam(format string, args ...interface{}) error {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		EResult: steaminventory.EResultInvalidParam,
+		Msg:     fmt.Sprintf(format, args...),
+	}
+}
+
+// InventoryService is a mock of Steam's IInventoryService Web API for a
+// single app, with every player's inventory kept in memory.
+type InventoryService struct {
+	defs  map[int32]*steaminventory.ItemDef
+	appID int32
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	roller  steaminventory.Roller
+	ids     steaminventory.ItemIDAllocator
+	players map[uint64]*steaminventory.SimulatedPlayer
+
+	// time of each player's last TriggerItemDrop call; the time between
+	// calls counts as playtime
+	lastTrigger map[uint64]time.Time
+
+	// if not nil, players are loaded from the store and every change is
+	// saved in it
+	store *InventoryStore
+}
+
+func newInventoryService(defs map[int32]*steaminventory.ItemDef, appID int32, r steaminventory.Roller) *InventoryService {
+	return &InventoryService{
+		defs:        defs,
+		appID:       appID,
+		now:         time.Now,
+		roller:      r,
+		players:     make(map[uint64]*steaminventory.SimulatedPlayer),
+		lastTrigger: make(map[uint64]time.Time),
+	}
+}
+
+type apiMethod struct {
+	post bool
+	run  func(s *InventoryService, req *apiRequest) (interface{}, error)
+}
+
+var inventoryServiceMethods = map[string]apiMethod{
+	"AddItem":         {post: true, run: (*InventoryService).addItem},
+	"AddPromoItem":    {post: true, run: (*InventoryService).addPromoItem},
+	"ConsumeItem":     {post: true, run: (*InventoryService).consumeItem},
+	"ExchangeItem":    {post: true, run: (*InventoryService).exchangeItem},
+	"GetInventory":    {run: (*InventoryService).getInventory},
+	"GetItemDefs":     {run: (*InventoryService).getItemDefs},
+	"ModifyItems":     {post: true, run: (*InventoryService).modifyItems},
+	"TriggerItemDrop": {post: true, run: (*InventoryService).triggerItemDrop},
+}
+
+func (s *InventoryService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "IInventoryService" || parts[2] != "v1" {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	method, ok := inventoryServiceMethods[parts[1]]
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if method.post && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeAPIError(w, invalidParam("%v", err))
+
+		return
+	}
+
+	req := &apiRequest{params: r.Form}
+
+	result, err := s.handle(method, req)
+
+	if err != nil {
+		writeAPIError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("x-eresult", strconv.Itoa(steaminventory.EResultOK))
+	_ = json.NewEncoder(w).Encode(struct {
+		Response interface{} `json:"response"`
+	}{result})
+}
+
+// handle runs method with the service locked. The lock is released even if
+// the method panics, so that net/http can recover and keep serving.
+func (s *InventoryService) handle(method apiMethod, req *apiRequest) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appID, err := req.int32("appid")
+	if err != nil {
+		return nil, err
+	}
+
+	if appID != s.appID {
+		return nil, invalidParam("unknown appid %d", appID)
+	}
+
+	return method.run(s, req)
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	apiErr := apiErrorFor(err)
+
+	w.Header().Set("x-eresult", strconv.Itoa(apiErr.EResult))
+	http.Error(w, apiErr.Msg, apiErr.Status)
+}
+
+// apiErrorFor returns the HTTP status and EResult code for an error from an
+// inventory operation.
+func apiErrorFor(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	apiErr = &APIError{
+		Status:  http.StatusInternalServerError,
+		EResult: steaminventory.EResultFor(err),
+		Msg:     err.Error(),
+	}
+
+	switch apiErr.EResult {
+	case steaminventory.EResultFileNotFound:
+		apiErr.Status = http.StatusNotFound
+	case steaminventory.EResultAccessDenied:
+		apiErr.Status = http.StatusForbidden
+	case steaminventory.EResultInvalidParam, steaminventory.EResultLimitExceeded, steaminventory.EResultNoMatch:
+		apiErr.Status = http.StatusBadRequest
+	}
+
+	return apiErr
+}
+
+// apiRequest reads Web API parameters, including arrays passed as name[0],
+// name[1], and so on.
+type apiRequest struct {
+	params map[string][]string
+}
+
+func (r *apiRequest) has(name string) bool {
+	_, ok := r.params[name]
+
+	return ok
+}
+
+func (r *apiRequest) uint64(name string) (uint64, error) {
+	v, err := strconv.ParseUint(r.get(name), 10, 64)
+	if err != nil {
+		return 0, invalidParam("invalid %s %q", name, r.get(name))
+	}
+
+	return v, nil
+}
+
+func (r *apiRequest) int32(name string) (int32, error) {
+	v, err := strconv.ParseInt(r.get(name), 10, 32)
+	if err != nil {
+		return 0, invalidParam("invalid %s %q", name, r.get(name))
+	}
+
+	return int32(v), nil
+}
+
+func (r *apiRequest) get(name string) string {
+	if v := r.params[name]; len(v) != 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// count returns the length of the array parameter name.
+func (r *apiRequest) count(name string) int {
+	n := 0
+	for r.has(name + "[" + strconv.Itoa(n) + "]") {
+		n++
+	}
+
+	return n
+}
+
+func (r *apiRequest) index(name string, i int) string {
+	return name + "[" + strconv.Itoa(i) + "]"
+}
+
+func (s *InventoryService) player(req *apiRequest) (uint64, *steaminventory.SimulatedPlayer, error) {
+	steamID, err := req.uint64("steamid")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return steamID, s.playerByID(steamID), nil
+}
+
+func (s *InventoryService) playerByID(steamID uint64) *steaminventory.SimulatedPlayer {
+	if s.store != nil {
+		return s.store.player(steamID)
+	}
+
+	p, ok := s.players[steamID]
+	if !ok {
+		p = steaminventory.NewSimulatedPlayer(&s.ids)
+		s.players[steamID] = p
+	}
+
+	return p
+}
+
+// record saves the items changed by a method in the store, if there is one.
+func (s *InventoryService) record(steamID uint64, method string, player *steaminventory.SimulatedPlayer, changed []*steaminventory.ItemInstance) error {
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.record(steamID, method, s.now(), player, changed)
+}
+
+func (s *InventoryService) itemDef(id int32) (*steaminventory.ItemDef, error) {
+	def, ok := s.defs[id]
+	if !ok {
+		return nil, invalidParam("unknown itemdefid %d", id)
+	}
+
+	if def.Type == "tag_generator" {
+		return nil, invalidParam("item %d is a tag_generator", id)
+	}
+
+	return def, nil
+}
+
+type itemJSONResponse struct {
+	ItemJSON string `json:"item_json"`
+}
+
+func itemJSON(items []*steaminventory.ItemInstance) (interface{}, error) {
+	b, err := json.Marshal(steaminventory.SteamItems(items))
+	if err != nil {
+		return nil, err
+	}
+
+	return itemJSONResponse{ItemJSON: string(b)}, nil
+}
+
+func (s *InventoryService) addItem(req *apiRequest) (interface{}, error) {
+	steamID, player, err := s.player(req)
+	if err != nil {
+		return nil, err
+	}
+
+	n := req.count("itemdefid")
+	if n == 0 {
+		return nil, invalidParam("missing itemdefid[0]")
+	}
+
+	items := make(steaminventory.TaggedBundleDefs, n)
+	for i := range items {
+		id, err := req.int32(req.index("itemdefid", i))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = s.itemDef(id); err != nil {
+			return nil, err
+		}
+
+		items[i] = steaminventory.TaggedBundleDef{Item: id, Quantity: 1}
+	}
+
+	generated, err := steaminventory.GenerateItems(s.defs, items, s.roller)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := player.Inventory.Grant(s.defs, generated, s.now(), steaminventory.OriginExternal)
+	if err = s.record(steamID, "AddItem", player, granted); err != nil {
+		return nil, err
+	}
+
+	return itemJSON(granted)
+}
+
+func (s *InventoryService) addPromoItem(req *apiRequest) (interface{}, error) {
+	steamID, player, err := s.player(req)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := req.int32("itemdefid")
+	if err != nil {
+		return nil, err
+	}
+
+	def, err := s.itemDef(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if def.Promo == "" {
+		return nil, &APIError{
+			Status:  http.StatusForbidden,
+			EResult: steaminventory.EResultAccessDenied,
+			Msg:     fmt.Sprintf("item %d is not a promo item", id),
+		}
+	}
+
+	// promo items are only granted once
+	if player.ClaimedPromos[id] {
+		return itemJSON(nil)
+	}
+
+	generated, err := steaminventory.GenerateItems(s.defs, steaminventory.TaggedBundleDefs{{Item: id, Quantity: 1}}, s.roller)
+	if err != nil {
+		return nil, err
+	}
+
+	if player.ClaimedPromos == nil {
+		player.ClaimedPromos = make(map[int32]bool)
+	}
+	player.ClaimedPromos[id] = true
+
+	granted := player.Inventory.Grant(s.defs, generated, s.now(), steaminventory.OriginPromo)
+	if err = s.record(steamID, "AddPromoItem", player, granted); err != nil {
+		return nil, err
+	}
+
+	return itemJSON(granted)
+}
+
+func (s *InventoryService) consumeItem(req *apiRequest) (interface{}, error) {
+	steamID, player, err := s.player(req)
+	if err != nil {
+		return nil, err
+	}
+
+	itemID, err := req.uint64("itemid")
+	if err != nil {
+		return nil, err
+	}
+
+	quantity := int32(1)
+	if req.has("quantity") {
+		quantity, err = req.int32("quantity")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if quantity <= 0 {
+		return nil, invalidParam("invalid quantity %d", quantity)
+	}
+
+	item := player.Inventory.Find(itemID)
+	if item == nil {
+		return nil, &steaminventory.ItemNotFoundError{ItemID: itemID}
+	}
+
+	if err = player.Inventory.Consume(itemID, quantity); err != nil {
+		return nil, err
+	}
+
+	if err = s.record(steamID, "ConsumeItem", player, []*steaminventory.ItemInstance{item}); err != nil {
+		return nil, err
+	}
+
+	return itemJSON([]*steaminventory.ItemInstance{item})
+}
+
+func (s *InventoryService) exchangeItem(req *apiRequest) (interface{}, error) {
+	steamID, player, err := s.player(req)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := req.int32("outputitemdefid")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.itemDef(target); err != nil {
+		return nil, err
+	}
+
+	n := req.count("materialsitemid")
+	if n == 0 || req.count("materialsquantity") != n {
+		return nil, invalidParam("materialsitemid and materialsquantity must have the same non-zero length")
+	}
+
+	materials := make([]steaminventory.ExchangeMaterial, n)
+	for i := range materials {
+		materials[i].ItemID, err = req.uint64(req.index("materialsitemid", i))
+		if err != nil {
+			return nil, err
+		}
+
+		materials[i].Quantity, err = req.int32(req.index("materialsquantity", i))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changed, err := player.Exchange(s.defs, materials, target, s.roller, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.record(steamID, "ExchangeItem", player, changed); err != nil {
+		return nil, err
+	}
+
+	return itemJSON(changed)
+}
+
+func (s *InventoryService) getInventory(req *apiRequest) (interface{}, error) {
+	_, player, err := s.player(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return itemJSON(player.Inventory.Items)
+}
+
+func (s *InventoryService) getItemDefs(req *apiRequest) (interface{}, error) {
+	var ids []int32
+	if n := req.count("itemdefids"); n != 0 {
+		for i := 0; i < n; i++ {
+			id, err := req.int32(req.index("itemdefids", i))
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := s.defs[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		for id := range s.defs {
+			ids = append(ids, id)
+		}
+
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+	}
+
+	defs := make([]*steaminventory.ItemDef, len(ids))
+	for i, id := range ids {
+		defs[i] = s.defs[id]
+	}
+
+	b, err := json.Marshal(defs)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		ItemDefJSON string `json:"itemdef_json"`
+	}{string(b)}, nil
+}
+
+// ItemUpdate is an entry in the input_json of ModifyItems. An update either
+// sets or removes a dynamic property, or applies the tag tool with
+// ToolItemID to the item. Steam has no way to apply tag tools from the Web
+// API; the mock accepts tool_itemid so that servers can attach Strange
+// Devices.
+type ItemUpdate struct {
+	ItemID         uint64 `json:"itemid,string"`
+	PropertyName   string `json:"property_name"`
+	PropertyInt    *int64 `json:"property_value_int"`
+	PropertyBool   *bool  `json:"property_value_bool"`
+	RemoveProperty bool   `json:"remove_property"`
+	ToolItemID     uint64 `json:"tool_itemid,string,omitempty"`
+}
+
+func (s *InventoryService) modifyItems(req *apiRequest) (interface{}, error) {
+	var input struct {
+		SteamID uint64       `json:"steamid,string"`
+		Updates []ItemUpdate `json:"updates"`
+	}
+
+	if err := json.Unmarshal([]byte(req.get("input_json")), &input); err != nil {
+		return nil, invalidParam("invalid input_json: %v", err)
+	}
+
+	player := s.playerByID(input.SteamID)
+
+	// check every update before changing anything; an item can only be
+	// used by one tool update, so that checking each one on its own is
+	// enough
+	items := make([]*steaminventory.ItemInstance, len(input.Updates))
+	tools := make([]*steaminventory.ItemInstance, len(input.Updates))
+	usedByTools := make(map[uint64]bool)
+	for i, update := range input.Updates {
+		if update.ToolItemID != 0 {
+			if update.PropertyName != "" || update.PropertyInt != nil || update.PropertyBool != nil || update.RemoveProperty {
+				return nil, invalidParam("update %d applies a tool and changes a property", i)
+			}
+
+			if usedByTools[update.ToolItemID] || usedByTools[update.ItemID] {
+				return nil, invalidParam("update %d uses an item that another tool update already uses", i)
+			}
+			usedByTools[update.ToolItemID] = true
+			usedByTools[update.ItemID] = true
+
+			var err error
+			tools[i], items[i], err = player.Inventory.CheckTagTool(s.defs, update.ToolItemID, update.ItemID)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		items[i] = player.Inventory.Find(update.ItemID)
+		if items[i] == nil {
+			return nil, &steaminventory.ItemNotFoundError{ItemID: update.ItemID}
+		}
+
+		if !steaminventory.DeclaresProperty(s.defs[items[i].Item], update.PropertyName) && !items[i].HasCounter(s.defs, update.PropertyName) {
+			return nil, invalidParam("item %d does not have dynamic property %q", update.ItemID, update.PropertyName)
+		}
+
+		if !update.RemoveProperty && update.PropertyInt == nil && update.PropertyBool == nil {
+			return nil, invalidParam("update %d has no integer or boolean value", i)
+		}
+	}
+
+	now := s.now()
+
+	var modified []*steaminventory.ItemInstance
+	for i, update := range input.Updates {
+		item := items[i]
+
+		switch {
+		case tools[i] != nil:
+			if _, err := player.Inventory.ApplyTagTool(s.defs, update.ToolItemID, update.ItemID, now); err != nil {
+				return nil, err
+			}
+
+			modified = append(modified, tools[i])
+		case update.RemoveProperty:
+			delete(item.DynamicProps, update.PropertyName)
+		default:
+			value := int64(0)
+			if update.PropertyInt != nil {
+				value = *update.PropertyInt
+			} else if *update.PropertyBool {
+				value = 1
+			}
+
+			if item.DynamicProps == nil {
+				item.DynamicProps = make(map[string]int64)
+			}
+			item.DynamicProps[update.PropertyName] = value
+		}
+
+		if len(modified) == 0 || modified[len(modified)-1] != item {
+			modified = append(modified, item)
+		}
+	}
+
+	if err := s.record(input.SteamID, "ModifyItems", player, modified); err != nil {
+		return nil, err
+	}
+
+	return itemJSON(modified)
+}
+
+func (s *InventoryService) triggerItemDrop(req *apiRequest) (interface{}, error) {
+	steamID, err := req.uint64("steamid")
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := req.int32("itemdefid")
+	if err != nil {
+		return nil, err
+	}
+
+	def, err := s.itemDef(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if def.Type != "playtimegenerator" {
+		return nil, invalidParam("item %d is not a playtimegenerator", id)
+	}
+
+	player := s.playerByID(steamID)
+	now := s.now()
+
+	if last, ok := s.lastTrigger[steamID]; ok && now.After(last) {
+		player.Play(now.Sub(last))
+	}
+	s.lastTrigger[steamID] = now
+
+	dropped, err := player.TriggerItemDrop(s.defs, s.roller, id, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.record(steamID, "TriggerItemDrop", player, dropped); err != nil {
+		return nil, err
+	}
+
+	return itemJSON(dropped)
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenLubar/toy-steam-inventory/steaminventory"
+)
+
+const testAppID = 563560
+
+// newTestService returns a service for defs whose clock starts at the
+// beginning of a scenario and moves forward a minute every call.
+func newTestService(defs map[int32]*steaminventory.ItemDef) *InventoryService {
+	s := newInventoryService(defs, testAppID, steaminventory.NewRoller(1))
+
+	now := scenarioStart
+	s.now = func() time.Time {
+		now = now.Add(time.Minute)
+
+		return now
+	}
+
+	return s
+}
+
+// callAPI calls a method of the service and returns the HTTP status, the
+// x-eresult header, and the body. The appid is set to testAppID unless
+// params has one.
+func callAPI(t *testing.T, s *InventoryService, httpMethod, method string, params url.Values) (int, int, string) {
+	t.Helper()
+
+	if params == nil {
+		params = url.Values{}
+	}
+	if !params.Has("appid") {
+		params.Set("appid", strconv.Itoa(testAppID))
+	}
+
+	var req *http.Request
+	if httpMethod == http.MethodPost {
+		req = httptest.NewRequest(httpMethod, "/IInventoryService/"+method+"/v1", strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(httpMethod, "/IInventoryService/"+method+"/v1?"+params.Encode(), nil)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	eresult, _ := strconv.Atoi(w.Header().Get("x-eresult"))
+
+	return w.Code, eresult, w.Body.String()
+}
+
+// apiItems decodes the item_json of a successful response.
+func apiItems(t *testing.T, body string) []steaminventory.SteamItem {
+	t.Helper()
+
+	var response struct {
+		Response itemJSONResponse `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+
+	var items []steaminventory.SteamItem
+	if err := json.Unmarshal([]byte(response.Response.ItemJSON), &items); err != nil {
+		t.Fatalf("%v: %s", err, response.Response.ItemJSON)
+	}
+
+	return items
+}
+
+func TestInventoryServiceRequests(t *testing.T) {
+	const steamID = steamIDBase + 1
+
+	// params is given the item ID of a stack of 2 of item 3001 that the
+	// player has before the request
+	tests := []struct {
+		name       string
+		httpMethod string
+		method     string
+		params     func(itemID uint64) url.Values
+		status     int
+		eresult    int
+
+		// if not nil, check is called with the body of the response
+		check func(t *testing.T, body string)
+	}{
+		{
+			name:       "unknown appid",
+			httpMethod: http.MethodGet,
+			method:     "GetInventory",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"appid": {"440"}, "steamid": {strconv.FormatUint(steamID, 10)}}
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name:       "missing appid",
+			httpMethod: http.MethodGet,
+			method:     "GetInventory",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"appid": {""}, "steamid": {strconv.FormatUint(steamID, 10)}}
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name:       "unknown method",
+			httpMethod: http.MethodGet,
+			method:     "GetEverything",
+			status:     http.StatusNotFound,
+		},
+		{
+			name:       "GET of a POST method",
+			httpMethod: http.MethodGet,
+			method:     "AddItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemdefid[0]": {"3001"}}
+			},
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "GetInventory",
+			httpMethod: http.MethodGet,
+			method:     "GetInventory",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}}
+			},
+			status:  http.StatusOK,
+			eresult: steaminventory.EResultOK,
+			check: func(t *testing.T, body string) {
+				items := apiItems(t, body)
+				if len(items) != 1 || items[0].ItemDefID != 3001 || items[0].Quantity != 2 {
+					t.Errorf("got inventory %+v, want 2 of item 3001", items)
+				}
+			},
+		},
+		{
+			name:       "GetInventory of a new player",
+			httpMethod: http.MethodGet,
+			method:     "GetInventory",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID+1, 10)}}
+			},
+			status:  http.StatusOK,
+			eresult: steaminventory.EResultOK,
+			check: func(t *testing.T, body string) {
+				if items := apiItems(t, body); len(items) != 0 {
+					t.Errorf("got inventory %+v, want no items", items)
+				}
+			},
+		},
+		{
+			name:       "AddItem",
+			httpMethod: http.MethodPost,
+			method:     "AddItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemdefid[0]": {"3001"}, "itemdefid[1]": {"3002"}}
+			},
+			status:  http.StatusOK,
+			eresult: steaminventory.EResultOK,
+			check: func(t *testing.T, body string) {
+				items := apiItems(t, body)
+				if len(items) != 2 || items[0].ItemDefID != 3001 || items[1].ItemDefID != 3002 || items[0].Origin != steaminventory.OriginExternal {
+					t.Errorf("got items %+v, want one each of 3001 and 3002", items)
+				}
+			},
+		},
+		{
+			name:       "AddItem unknown item",
+			httpMethod: http.MethodPost,
+			method:     "AddItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemdefid[0]": {"12345"}}
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name:       "AddItem without items",
+			httpMethod: http.MethodPost,
+			method:     "AddItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}}
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name:       "ConsumeItem",
+			httpMethod: http.MethodPost,
+			method:     "ConsumeItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemid": {strconv.FormatUint(itemID, 10)}}
+			},
+			status:  http.StatusOK,
+			eresult: steaminventory.EResultOK,
+			check: func(t *testing.T, body string) {
+				if items := apiItems(t, body); len(items) != 1 || items[0].Quantity != 1 {
+					t.Errorf("got items %+v, want 1 item left", items)
+				}
+			},
+		},
+		{
+			name:       "ConsumeItem quantity 0",
+			httpMethod: http.MethodPost,
+			method:     "ConsumeItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemid": {strconv.FormatUint(itemID, 10)}, "quantity": {"0"}}
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name:       "ConsumeItem too many",
+			httpMethod: http.MethodPost,
+			method:     "ConsumeItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemid": {strconv.FormatUint(itemID, 10)}, "quantity": {"3"}}
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultLimitExceeded,
+		},
+		{
+			name:       "ConsumeItem missing item",
+			httpMethod: http.MethodPost,
+			method:     "ConsumeItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemid": {strconv.FormatUint(itemID+100, 10)}}
+			},
+			status:  http.StatusNotFound,
+			eresult: steaminventory.EResultFileNotFound,
+		},
+		{
+			name:       "AddPromoItem not a promo",
+			httpMethod: http.MethodPost,
+			method:     "AddPromoItem",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"steamid": {strconv.FormatUint(steamID, 10)}, "itemdefid": {"3001"}}
+			},
+			status:  http.StatusForbidden,
+			eresult: steaminventory.EResultAccessDenied,
+		},
+		{
+			name:       "GetItemDefs",
+			httpMethod: http.MethodGet,
+			method:     "GetItemDefs",
+			params: func(itemID uint64) url.Values {
+				return url.Values{"itemdefids[0]": {"3001"}, "itemdefids[1]": {"12345"}}
+			},
+			status:  http.StatusOK,
+			eresult: steaminventory.EResultOK,
+			check: func(t *testing.T, body string) {
+				var response struct {
+					Response struct {
+						ItemDefJSON string `json:"itemdef_json"`
+					} `json:"response"`
+				}
+				if err := json.Unmarshal([]byte(body), &response); err != nil {
+					t.Fatalf("%v: %s", err, body)
+				}
+
+				var defs []map[string]interface{}
+				if err := json.Unmarshal([]byte(response.Response.ItemDefJSON), &defs); err != nil {
+					t.Fatalf("%v: %s", err, response.Response.ItemDefJSON)
+				}
+
+				if len(defs) != 1 || defs[0]["itemdefid"] != 3001.0 {
+					t.Fatalf("got item definitions %v, want only 3001", defs)
+				}
+
+				for field, value := range defs[0] {
+					if value == "" || value == nil {
+						t.Errorf("empty field %q", field)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := testItemDefs(t)
+			s := newTestService(defs)
+
+			item := s.playerByID(steamID).Inventory.Add(3001, 2, nil, scenarioStart, steaminventory.OriginExternal)
+
+			var params url.Values
+			if tt.params != nil {
+				params = tt.params(item.ItemID)
+			}
+
+			status, eresult, body := callAPI(t, s, tt.httpMethod, tt.method, params)
+			if status != tt.status || eresult != tt.eresult {
+				t.Fatalf("got status %d, eresult %d (%s), want %d, %d", status, eresult, body, tt.status, tt.eresult)
+			}
+
+			if tt.check != nil {
+				tt.check(t, body)
+			}
+		})
+	}
+}
+
+func TestModifyItemsTagTool(t *testing.T) {
+	const steamID = steamIDBase + 1
+
+	tests := []struct {
+		name    string
+		updates func(tool, target, other uint64) string
+		status  int
+		eresult int
+		tags    steaminventory.KeyValuePairs
+	}{
+		{
+			name: "apply",
+			updates: func(tool, target, other uint64) string {
+				return `[{"itemid":"` + strconv.FormatUint(target, 10) + `","tool_itemid":"` + strconv.FormatUint(tool, 10) + `"}]`
+			},
+			status:  http.StatusOK,
+			eresult: steaminventory.EResultOK,
+			tags:    steaminventory.KeyValuePairs{{Key: "strange", Value: "5000"}},
+		},
+		{
+			name: "not a tag tool",
+			updates: func(tool, target, other uint64) string {
+				return `[{"itemid":"` + strconv.FormatUint(target, 10) + `","tool_itemid":"` + strconv.FormatUint(other, 10) + `"}]`
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name: "missing tool",
+			updates: func(tool, target, other uint64) string {
+				return `[{"itemid":"` + strconv.FormatUint(target, 10) + `","tool_itemid":"999"}]`
+			},
+			status:  http.StatusNotFound,
+			eresult: steaminventory.EResultFileNotFound,
+		},
+		{
+			name: "tool and property",
+			updates: func(tool, target, other uint64) string {
+				return `[{"itemid":"` + strconv.FormatUint(target, 10) + `","tool_itemid":"` + strconv.FormatUint(tool, 10) + `","property_name":"strange_5000","property_value_int":5}]`
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+		{
+			name: "tool used twice",
+			updates: func(tool, target, other uint64) string {
+				update := `{"itemid":"` + strconv.FormatUint(target, 10) + `","tool_itemid":"` + strconv.FormatUint(tool, 10) + `"}`
+
+				return "[" + update + "," + update + "]"
+			},
+			status:  http.StatusBadRequest,
+			eresult: steaminventory.EResultInvalidParam,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := testItemDefs(t)
+			s := newTestService(defs)
+
+			inv := s.playerByID(steamID).Inventory
+			granted := inv.Grant(defs, steaminventory.TaggedBundleDefs{{Item: 5000, Quantity: 1}, {Item: 3001, Quantity: 1}, {Item: 4000, Quantity: 1}}, scenarioStart, steaminventory.OriginExternal)
+			tool, target, other := granted[0], granted[1], granted[2]
+
+			input := `{"steamid":"` + strconv.FormatUint(steamID, 10) + `","updates":` + tt.updates(tool.ItemID, target.ItemID, other.ItemID) + `}`
+			status, eresult, body := callAPI(t, s, http.MethodPost, "ModifyItems", url.Values{"input_json": {input}})
+			if status != tt.status || eresult != tt.eresult {
+				t.Fatalf("got status %d, eresult %d (%s), want %d, %d", status, eresult, body, tt.status, tt.eresult)
+			}
+
+			if tt.status != http.StatusOK {
+				if tool.Quantity != 1 || len(target.Tags) != 0 {
+					t.Errorf("a refused update changed the inventory")
+				}
+
+				return
+			}
+
+			items := apiItems(t, body)
+			if len(items) != 2 || items[0].ItemID != tool.ItemID || items[0].Quantity != 0 || items[1].ItemID != target.ItemID {
+				t.Fatalf("got items %+v, want the used tool and the target", items)
+			}
+
+			if !tagsEqual(items[1].Tags, tt.tags) || items[1].DynamicProps["strange_5000"] != 0 {
+				t.Errorf("target has tags %v and properties %v, want %v with a strange_5000 counter", items[1].Tags, items[1].DynamicProps, tt.tags)
+			}
+
+			if len(inv.Events) != 2 || inv.Events[1].Action != steaminventory.EventToolApplied {
+				t.Errorf("got events %+v, want the tool to be consumed and applied", inv.Events)
+			}
+		})
+	}
+}
+
+func TestExchangeItemExtractsDevices(t *testing.T) {
+	const steamID = steamIDBase + 1
+
+	tests := []struct {
+		name    string
+		target  int32
+		status  int
+		eresult int
+	}{
+		{name: "extract", target: 5000, status: http.StatusOK, eresult: steaminventory.EResultOK},
+		{name: "device not attached", target: 5001, status: http.StatusBadRequest, eresult: steaminventory.EResultNoMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := testItemDefs(t)
+			s := newTestService(defs)
+
+			granted := s.playerByID(steamID).Inventory.Grant(defs, steaminventory.TaggedBundleDefs{{Item: 4000, Quantity: 1}, {Item: 3001, Quantity: 1, Tags: steaminventory.KeyValuePairs{{Key: "strange", Value: "5000"}}}}, scenarioStart, steaminventory.OriginExternal)
+
+			status, eresult, body := callAPI(t, s, http.MethodPost, "ExchangeItem", url.Values{
+				"steamid":              {strconv.FormatUint(steamID, 10)},
+				"outputitemdefid":      {strconv.Itoa(int(tt.target))},
+				"materialsitemid[0]":   {strconv.FormatUint(granted[0].ItemID, 10)},
+				"materialsquantity[0]": {"1"},
+				"materialsitemid[1]":   {strconv.FormatUint(granted[1].ItemID, 10)},
+				"materialsquantity[1]": {"1"},
+			})
+			if status != tt.status || eresult != tt.eresult {
+				t.Fatalf("got status %d, eresult %d (%s), want %d, %d", status, eresult, body, tt.status, tt.eresult)
+			}
+
+			if status != http.StatusOK {
+				return
+			}
+
+			items := apiItems(t, body)
+			if len(items) != 3 || items[0].ItemDefID != tt.target || items[1].Quantity != 0 || items[2].Quantity != 0 {
+				t.Errorf("got %+v, want the device followed by the used tool and host", items)
+			}
+		})
+	}
+}
+
+func TestExchangeItemRedeemsTokens(t *testing.T) {
+	const steamID = steamIDBase + 1
+
+	tests := []struct {
+		name    string
+		classes []string
+		status  int
+		eresult int
+	}{
+		{name: "unlocked class", classes: []string{"officer"}, status: http.StatusOK, eresult: steaminventory.EResultOK},
+		{name: "class not unlocked", status: http.StatusForbidden, eresult: steaminventory.EResultAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := testItemDefs(t)
+			s := newTestService(defs)
+
+			player := s.playerByID(steamID)
+			player.Classes = tt.classes
+			token := player.Inventory.Grant(defs, steaminventory.TaggedBundleDefs{{Item: 4001, Quantity: 1}}, scenarioStart, steaminventory.OriginPromo)[0]
+
+			status, eresult, body := callAPI(t, s, http.MethodPost, "ExchangeItem", url.Values{
+				"steamid":              {strconv.FormatUint(steamID, 10)},
+				"outputitemdefid":      {"1000"},
+				"materialsitemid[0]":   {strconv.FormatUint(token.ItemID, 10)},
+				"materialsquantity[0]": {"1"},
+			})
+			if status != tt.status || eresult != tt.eresult {
+				t.Fatalf("got status %d, eresult %d (%s), want %d, %d", status, eresult, body, tt.status, tt.eresult)
+			}
+
+			if status == http.StatusOK {
+				if items := apiItems(t, body); len(items) != 2 || items[0].ItemDefID != 1000 || items[1].Quantity != 0 {
+					t.Errorf("got %+v, want item 1000 and the used token", items)
+				}
+			}
+		})
+	}
+}
+
+func tagsEqual(a, b steaminventory.KeyValuePairs) bool {
+	return steaminventory.TagsKey(a) == steaminventory.TagsKey(b)
+}
+
+func TestInventoryServiceUnlocksAfterPanic(t *testing.T) {
+	s := newTestService(testItemDefs(t))
+
+	inventoryServiceMethods["Panic"] = apiMethod{run: func(s *InventoryService, req *apiRequest) (interface{}, error) {
+		panic("method failed")
+	}}
+	t.Cleanup(func() { delete(inventoryServiceMethods, "Panic") })
+
+	// net/http recovers from panics in handlers and keeps serving
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("method did not panic")
+			}
+		}()
+
+		callAPI(t, s, http.MethodGet, "Panic", nil)
+	}()
+
+	if !s.mu.TryLock() {
+		t.Fatal("service is still locked after a method panicked")
+	}
+	s.mu.Unlock()
+}